@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// authoritativePort is the port used to reach authoritative nameservers. Tests point it at local servers.
+var authoritativePort = 53
+
+// FindZone asks the resolver for the SOA of name and returns the apex of the zone that contains it.
+func FindZone(ctx context.Context, client *dns.Client, resolver DNSServer, name string) (string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dns.TypeSOA)
+	m.RecursionDesired = true
+	resp, _, err := ExchangeContext(ctx, client, m, resolver.AddressString())
+	if err != nil {
+		return "", err
+	}
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns} {
+		for _, rr := range section {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return strings.ToLower(soa.Hdr.Name), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no SOA found for %s", name)
+}
+
+// AuthoritativeServers returns the nameservers of zone, resolved to addresses through the resolver.
+func AuthoritativeServers(ctx context.Context, client *dns.Client, resolver DNSServer, zone string) ([]DNSServer, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(zone), dns.TypeNS)
+	m.RecursionDesired = true
+	resp, _, err := ExchangeContext(ctx, client, m, resolver.AddressString())
+	if err != nil {
+		return nil, err
+	}
+	servers := make([]DNSServer, 0, len(resp.Answer))
+	for _, rr := range resp.Answer {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		for _, address := range resolveHost(ctx, client, resolver, ns.Ns, resp.Extra) {
+			servers = append(servers, DNSServer{Name: ns.Ns, Address: address, Port: authoritativePort})
+		}
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no nameservers found for %s", zone)
+	}
+	return servers, nil
+}
+
+// resolveHost returns the IPv4 addresses of host, preferring glue from extra.
+func resolveHost(ctx context.Context, client *dns.Client, resolver DNSServer, host string, extra []dns.RR) []string {
+	var addresses []string
+	for _, rr := range extra {
+		if a, ok := rr.(*dns.A); ok && strings.EqualFold(a.Hdr.Name, host) {
+			addresses = append(addresses, a.A.String())
+		}
+	}
+	if len(addresses) > 0 {
+		return addresses
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(host), dns.TypeA)
+	m.RecursionDesired = true
+	resp, _, err := ExchangeContext(ctx, client, m, resolver.AddressString())
+	if err != nil {
+		return nil
+	}
+	for _, rr := range resp.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			addresses = append(addresses, a.A.String())
+		}
+	}
+	return addresses
+}
+
+// QueryAuthoritative asks the authoritative servers for name and qtype with recursion disabled
+// and returns the first authoritative reply.
+func QueryAuthoritative(ctx context.Context, client *dns.Client, servers []DNSServer, name string, qtype uint16) (*dns.Msg, DNSServer, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = false
+	var lastErr error
+	for _, server := range servers {
+		resp, _, err := ExchangeContext(ctx, client, m, server.AddressString())
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !resp.Authoritative {
+			lastErr = fmt.Errorf("%s is not authoritative for %s", server.Name, name)
+			continue
+		}
+		return resp, server, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no authoritative servers for %s", name)
+	}
+	return nil, DNSServer{}, lastErr
+}
+
+// LookupAuthoritative finds the zone of name through the resolver and queries its nameservers directly.
+func LookupAuthoritative(ctx context.Context, client *dns.Client, resolver DNSServer, name string, qtype uint16) (*dns.Msg, DNSServer, error) {
+	zone, err := FindZone(ctx, client, resolver, name)
+	if err != nil {
+		return nil, DNSServer{}, err
+	}
+	servers, err := AuthoritativeServers(ctx, client, resolver, zone)
+	if err != nil {
+		return nil, DNSServer{}, err
+	}
+	return QueryAuthoritative(ctx, client, servers, name, qtype)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// maxBatchQuestions bounds the size of a single batch request.
+	maxBatchQuestions = 500
+	// maxBatchBody bounds the size of the JSON body of a batch request.
+	maxBatchBody = 1 << 20
+)
+
+// batchSlots limits the number of lookups running at once across every batch request.
+var batchSlots = make(chan struct{}, 8)
+
+// BatchQuestion is a single question of a batch. Options take the same keys as the lookup query parameters.
+type BatchQuestion struct {
+	Domain  string            `json:"domain"`
+	Type    string            `json:"type"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// BatchResponse holds the result of every question keyed by "domain/TYPE", followed by "?options" when
+// the question has options. Questions that did not finish before the deadline are listed in Pending.
+type BatchResponse struct {
+	Results             map[string]LookupResponse `json:"results"`
+	Errors              map[string]ErrorResponse  `json:"errors,omitempty"`
+	Pending             []string                  `json:"pending,omitempty"`
+	Complete            bool                      `json:"complete"`
+	TotalDuration       time.Duration             `json:"total_duration"`
+	TotalDurationString string                    `json:"total_duration_string"`
+
+	// order is the key of every question in the order they were submitted.
+	order []string
+}
+
+// Key identifies the question in the batch results by its normalized name, canonical type name and options,
+// so questions only differing in case or a trailing dot are looked up once.
+func (q BatchQuestion) Key() string {
+	name := q.Domain
+	if normalized, _, err := NormalizeDomain(q.Domain); err == nil {
+		name = normalized
+	}
+	qtype := strings.ToUpper(q.Type)
+	if parsed, err := ParseType(q.Type); err == nil {
+		qtype = dns.Type(parsed).String()
+	}
+	key := strings.ToLower(dns.Fqdn(name)) + "/" + qtype
+	if len(q.Options) > 0 {
+		options := url.Values{}
+		for option, value := range q.Options {
+			options.Set(option, value)
+		}
+		key += "?" + options.Encode()
+	}
+	return key
+}
+
+// parse runs the question through the same parsing as a lookup request.
+func (q BatchQuestion) parse() (*ParsedQuestion, error) {
+	query := url.Values{}
+	for key, value := range q.Options {
+		query.Set(key, value)
+	}
+	query.Set("domain", q.Domain)
+	query.Set("type", q.Type)
+	parsed, err := ParseURLQuery(&url.URL{RawQuery: query.Encode()})
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed.Types) > 1 {
+		return nil, fmt.Errorf("batch questions take a single type")
+	}
+	parsed.Domain = dns.Fqdn(parsed.Domain)
+	return parsed, nil
+}
+
+type batchResult struct {
+	key      string
+	response LookupResponse
+}
+
+// RunBatch looks up every question against the servers, returning whatever finished before the deadline.
+// Duplicate questions are only looked up once. Lookups still running when the deadline expires or ctx
+// is cancelled are cancelled as well.
+func RunBatch(ctx context.Context, client *dns.Client, questions []BatchQuestion, servers []DNSServer, deadline time.Duration) BatchResponse {
+	start := time.Now()
+	batch := BatchResponse{Results: map[string]LookupResponse{}, Errors: map[string]ErrorResponse{}}
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+
+	results := make(chan batchResult, len(questions))
+	pending := map[string]bool{}
+	for _, question := range questions {
+		key := question.Key()
+		if _, failed := batch.Errors[key]; pending[key] || failed {
+			continue
+		}
+		batch.order = append(batch.order, key)
+		parsed, err := question.parse()
+		if err != nil {
+			batch.Errors[key] = ErrorResponse{Code: ErrorCode(err), Error: err.Error()}
+			continue
+		}
+		pending[key] = true
+		go func(key string, parsed *ParsedQuestion) {
+			select {
+			case batchSlots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-batchSlots }()
+			response := Lookup(ctx, client, parsed, servers)
+			if ctx.Err() != nil {
+				// The lookup was cut short, leave the question pending.
+				return
+			}
+			results <- batchResult{key: key, response: response}
+		}(key, parsed)
+	}
+
+collect:
+	for len(pending) > 0 {
+		select {
+		case result := <-results:
+			batch.Results[result.key] = result.response
+			delete(pending, result.key)
+		case <-ctx.Done():
+			break collect
+		}
+	}
+	for _, key := range batch.order {
+		if pending[key] {
+			batch.Pending = append(batch.Pending, key)
+		}
+	}
+	batch.Complete = len(batch.Pending) == 0
+	if len(batch.Errors) == 0 {
+		batch.Errors = nil
+	}
+	batch.TotalDuration = time.Since(start)
+	batch.TotalDurationString = batch.TotalDuration.String()
+	return batch
+}
+
+// ExportRows flattens every finished lookup of the batch in the order the questions were submitted.
+func (b BatchResponse) ExportRows() []ExportRow {
+	rows := []ExportRow{}
+	for _, key := range b.order {
+		if response, ok := b.Results[key]; ok {
+			rows = append(rows, ExportRows(response)...)
+		}
+	}
+	return rows
+}
+
+// BatchEndpoint accepts a JSON list of questions and looks them all up. The deadline_ms query
+// parameter bounds the whole batch, questions still running when it expires are reported as pending.
+func BatchEndpoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		ErrorJSONResponse(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed, "Method not allowed, use POST")
+		return
+	}
+	deadline, err := QueryInt(r.URL.Query(), "deadline_ms", 30000, 100, 120000)
+	if err != nil {
+		QueryErrorResponse(w, err)
+		return
+	}
+	var questions []BatchQuestion
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody)).Decode(&questions); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ErrorJSONResponse(w, http.StatusRequestEntityTooLarge, ErrBatchTooLarge, fmt.Sprintf("Invalid batch: body is larger than %d bytes", tooLarge.Limit))
+			return
+		}
+		ErrorJSONResponse(w, http.StatusBadRequest, ErrInvalidBatch, fmt.Sprintf("Invalid batch: %v", err))
+		return
+	}
+	if len(questions) == 0 {
+		ErrorJSONResponse(w, http.StatusBadRequest, ErrInvalidBatch, "Invalid batch: must contain at least 1 question")
+		return
+	}
+	if len(questions) > maxBatchQuestions {
+		ErrorJSONResponse(w, http.StatusBadRequest, ErrBatchTooLarge, fmt.Sprintf("Invalid batch: must contain at most %d questions", maxBatchQuestions))
+		return
+	}
+	batch := RunBatch(r.Context(), NewClient(), questions, dnsServers, time.Duration(deadline)*time.Millisecond)
+	if !batch.Complete {
+		log.Printf("Batch deadline of %d ms expired with %d questions pending", deadline, len(batch.Pending))
+	}
+	switch ResponseFormat(r) {
+	case "csv":
+		CSVResponse(w, "batch.csv", batch.ExportRows())
+	case "ndjson":
+		NDJSONResponse(w, "batch.ndjson", batch.ExportRows())
+	default:
+		JSONResponse(w, batch)
+	}
+}
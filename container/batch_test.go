@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestRunBatch(t *testing.T) {
+	server := startTestDNSServer(t, "static", zoneHandler(false,
+		"example.com. 300 IN A 192.0.2.1",
+		"example.com. 300 IN MX 10 mail.example.com.",
+	))
+	questions := []BatchQuestion{
+		{Domain: "example.com", Type: "A"},
+		{Domain: "example.com", Type: "MX", Options: map[string]string{"sort": "answer"}},
+		{Domain: "example.com.", Type: "A"},
+		{Domain: "example.com", Type: "BOGUS"},
+	}
+	batch := RunBatch(context.Background(), NewClient(), questions, []DNSServer{server}, time.Second)
+	if !batch.Complete || len(batch.Pending) != 0 {
+		t.Errorf("Complete = %v, Pending = %v, want a complete batch", batch.Complete, batch.Pending)
+	}
+	if len(batch.Results) != 2 {
+		t.Fatalf("got %d results, want 2 after removing the duplicate", len(batch.Results))
+	}
+	if got := batch.Results["example.com./MX?sort=answer"].Answers[0].Values; !slices.Equal(got, []string{"10 mail.example.com."}) {
+		t.Errorf("MX values = %v", got)
+	}
+	if batch.Errors["example.com./BOGUS"] != (ErrorResponse{Code: ErrInvalidType, Error: "invalid DNS type: BOGUS"}) {
+		t.Errorf("Errors = %v", batch.Errors)
+	}
+	if !slices.Equal(batch.order, []string{"example.com./A", "example.com./MX?sort=answer", "example.com./BOGUS"}) {
+		t.Errorf("order = %v", batch.order)
+	}
+}
+
+func TestBatchQuestion_Key(t *testing.T) {
+	same := []BatchQuestion{
+		{Domain: "Example.com", Type: "a"},
+		{Domain: "example.com.", Type: "A"},
+		{Domain: "example.com", Type: "TYPE1"},
+	}
+	for _, q := range same {
+		if key := q.Key(); key != "example.com./A" {
+			t.Errorf("%+v: Key() = %q, want example.com./A", q, key)
+		}
+	}
+	a := BatchQuestion{Domain: "example.com", Type: "A", Options: map[string]string{"ecs": "192.0.2.0/24"}}
+	b := BatchQuestion{Domain: "example.com", Type: "A", Options: map[string]string{"ecs": "198.51.100.0/24"}}
+	if a.Key() == b.Key() {
+		t.Errorf("questions with different options share the key %q", a.Key())
+	}
+}
+
+func TestRunBatch_Deadline(t *testing.T) {
+	fast := startTestDNSServer(t, "fast", staticHandler("fast.example.com. 300 IN A 192.0.2.1"))
+	slow := startTestDNSServer(t, "slow", func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.Question[0].Name == "slow.example.com." {
+			time.Sleep(500 * time.Millisecond)
+		}
+		staticHandler()(w, r)
+	})
+	questions := []BatchQuestion{
+		{Domain: "fast.example.com", Type: "A"},
+		{Domain: "slow.example.com", Type: "A"},
+	}
+	batch := RunBatch(context.Background(), NewClient(), questions, []DNSServer{fast, slow}, 200*time.Millisecond)
+	if batch.Complete {
+		t.Error("Complete = true, want the deadline to expire")
+	}
+	if _, ok := batch.Results["fast.example.com./A"]; !ok {
+		t.Error("missing the partial result for the fast question")
+	}
+	if !slices.Equal(batch.Pending, []string{"slow.example.com./A"}) {
+		t.Errorf("Pending = %v", batch.Pending)
+	}
+}
+
+func TestBatchEndpoint(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "static", staticHandler("example.com. 300 IN A 192.0.2.1")))
+	body := `[{"domain":"example.com","type":"A"},{"domain":"example.org","type":"A","options":{"ttl_check":"false"}}]`
+
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	BatchEndpoint(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var batch BatchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &batch); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !batch.Complete || len(batch.Results) != 2 {
+		t.Errorf("batch = %+v", batch)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/batch?format=csv", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	BatchEndpoint(rr, req)
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(records) != 3 || records[1][3] != "example.com." || records[2][3] != "example.org." {
+		t.Errorf("CSV rows = %v, want a header and one row per question in order", records)
+	}
+}
+
+func TestBatchEndpoint_InvalidRequests(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		body   string
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/batch", "", http.StatusMethodNotAllowed, ErrMethodNotAllowed},
+		{http.MethodPost, "/batch", "{", http.StatusBadRequest, ErrInvalidBatch},
+		{http.MethodPost, "/batch", "[]", http.StatusBadRequest, ErrInvalidBatch},
+		{http.MethodPost, "/batch", "[" + strings.Repeat(`{"domain":"example.com","type":"A"},`, maxBatchQuestions) + `{}]`, http.StatusBadRequest, ErrBatchTooLarge},
+		{http.MethodPost, "/batch", `[{"domain":"` + strings.Repeat("a", maxBatchBody) + `"}]`, http.StatusRequestEntityTooLarge, ErrBatchTooLarge},
+		{http.MethodPost, "/batch?deadline_ms=5", `[{"domain":"example.com","type":"A"}]`, http.StatusBadRequest, ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		BatchEndpoint(rr, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+		var body ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s %s: invalid JSON error: %v", tt.method, tt.target, err)
+		}
+		if rr.Code != tt.status || body.Code != tt.code {
+			t.Errorf("%s %s %.20q status = %d, code = %q, want %d %q", tt.method, tt.target, tt.body, rr.Code, body.Code, tt.status, tt.code)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// answerSorters are the orderings accepted by the sort query parameter.
+var answerSorters = map[string]func(a, b DNSServerResponse) int{
+	"name": func(a, b DNSServerResponse) int {
+		return cmp.Or(cmp.Compare(a.DNSServer, b.DNSServer), cmp.Compare(a.Address, b.Address))
+	},
+	"latency": func(a, b DNSServerResponse) int {
+		return cmp.Or(cmp.Compare(a.Duration, b.Duration), cmp.Compare(a.DNSServer, b.DNSServer), cmp.Compare(a.Address, b.Address))
+	},
+	"answer": func(a, b DNSServerResponse) int {
+		return cmp.Or(cmp.Compare(a.AnswerHash, b.AnswerHash), cmp.Compare(a.DNSServer, b.DNSServer), cmp.Compare(a.Address, b.Address))
+	},
+}
+
+// SortAnswers orders the answers in place. An empty sortBy sorts by server name.
+func SortAnswers(answers []DNSServerResponse, sortBy string) error {
+	if sortBy == "" {
+		sortBy = "name"
+	}
+	sorter, ok := answerSorters[sortBy]
+	if !ok {
+		return fmt.Errorf("invalid sort: %s", sortBy)
+	}
+	slices.SortStableFunc(answers, sorter)
+	return nil
+}
+
+// CanonicalRR returns the record in presentation format with a lowercased owner name,
+// lowercased domain names in the rdata and without the TTL.
+func CanonicalRR(rr dns.RR) string {
+	rr = canonicalCopy(rr)
+	header := rr.Header()
+	return fmt.Sprintf("%s\t%s\t%s\t%s", header.Name, dns.ClassToString[header.Class], dns.Type(header.Rrtype).String(), RecordValue(rr))
+}
+
+// CanonicalValue returns the rdata of the record in canonical form.
+func CanonicalValue(rr dns.RR) string {
+	return RecordValue(canonicalCopy(rr))
+}
+
+func canonicalCopy(rr dns.RR) dns.RR {
+	rr = dns.Copy(rr)
+	header := rr.Header()
+	header.Name = strings.ToLower(header.Name)
+	header.Ttl = 0
+	switch v := rr.(type) {
+	case *dns.CNAME:
+		v.Target = strings.ToLower(v.Target)
+	case *dns.DNAME:
+		v.Target = strings.ToLower(v.Target)
+	case *dns.NS:
+		v.Ns = strings.ToLower(v.Ns)
+	case *dns.PTR:
+		v.Ptr = strings.ToLower(v.Ptr)
+	case *dns.MX:
+		v.Mx = strings.ToLower(v.Mx)
+	case *dns.SRV:
+		v.Target = strings.ToLower(v.Target)
+	case *dns.SOA:
+		v.Ns = strings.ToLower(v.Ns)
+		v.Mbox = strings.ToLower(v.Mbox)
+	}
+	return rr
+}
+
+// CanonicalOrder returns a copy of rrs sorted into canonical order, leaving the records as received untouched.
+func CanonicalOrder(rrs []dns.RR) []dns.RR {
+	sorted := slices.Clone(rrs)
+	slices.SortStableFunc(sorted, func(a, b dns.RR) int {
+		return cmp.Compare(CanonicalRR(a), CanonicalRR(b))
+	})
+	return sorted
+}
+
+// CanonicalizeAnswer returns a hash of the canonical answer set of msg without modifying it.
+// The rcode is part of the hash so that NXDOMAIN and an empty NOERROR answer are not considered the same.
+func CanonicalizeAnswer(msg *dns.Msg) string {
+	lines := make([]string, len(msg.Answer))
+	for i, rr := range msg.Answer {
+		lines[i] = CanonicalRR(rr)
+	}
+	slices.Sort(lines)
+	sum := sha256.Sum256([]byte(dns.RcodeToString[msg.Rcode] + "\n" + strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// RawSignature returns the answer section exactly as received, including TTLs and record order.
+func RawSignature(msg *dns.Msg) string {
+	lines := make([]string, len(msg.Answer))
+	for i, rr := range msg.Answer {
+		lines[i] = rr.String()
+	}
+	return dns.RcodeToString[msg.Rcode] + "\n" + strings.Join(lines, "\n")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func mustRR(t *testing.T, record string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(record)
+	if err != nil {
+		t.Fatalf("invalid record %q: %v", record, err)
+	}
+	return rr
+}
+
+func TestCanonicalizeAnswer_OrderAndCaseInsensitive(t *testing.T) {
+	a := &dns.Msg{Answer: []dns.RR{
+		mustRR(t, "Example.COM. 300 IN CNAME Target.Example.com."),
+		mustRR(t, "target.example.com. 300 IN A 192.0.2.2"),
+		mustRR(t, "target.example.com. 300 IN A 192.0.2.1"),
+	}}
+	b := &dns.Msg{Answer: []dns.RR{
+		mustRR(t, "target.example.com. 20 IN A 192.0.2.1"),
+		mustRR(t, "example.com. 20 IN CNAME target.example.com."),
+		mustRR(t, "target.example.com. 20 IN A 192.0.2.2"),
+	}}
+	if CanonicalizeAnswer(a) != CanonicalizeAnswer(b) {
+		t.Errorf("expected equal hashes for equivalent answer sets")
+	}
+	if a.Answer[1].(*dns.A).A.String() != "192.0.2.2" {
+		t.Errorf("expected the answer to keep the server order, got %v", a.Answer)
+	}
+	if sorted := CanonicalOrder(a.Answer); sorted[1].(*dns.A).A.String() != "192.0.2.1" {
+		t.Errorf("expected CanonicalOrder() to sort the records, got %v", sorted)
+	}
+
+	nxdomain := &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: dns.RcodeNameError}}
+	if CanonicalizeAnswer(nxdomain) == CanonicalizeAnswer(&dns.Msg{}) {
+		t.Errorf("expected NXDOMAIN and NODATA to hash differently")
+	}
+}
+
+func TestCanonicalRR_PreservesTXTCase(t *testing.T) {
+	got := CanonicalRR(mustRR(t, `Example.com. 300 IN TXT "Hello"`))
+	want := "example.com.\tIN\tTXT\t\"Hello\""
+	if got != want {
+		t.Errorf("CanonicalRR() = %q, want %q", got, want)
+	}
+}
+
+func TestSortAnswers(t *testing.T) {
+	answers := []DNSServerResponse{
+		{DNSServer: "b", Duration: time.Millisecond, AnswerHash: "1"},
+		{DNSServer: "c", Duration: 3 * time.Millisecond, AnswerHash: "0"},
+		{DNSServer: "a", Duration: 2 * time.Millisecond, AnswerHash: "1"},
+	}
+	for sortBy, want := range map[string]string{"": "abc", "latency": "bac", "answer": "cab"} {
+		if err := SortAnswers(answers, sortBy); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got := answers[0].DNSServer + answers[1].DNSServer + answers[2].DNSServer
+		if got != want {
+			t.Errorf("SortAnswers(%q) = %s, want %s", sortBy, got, want)
+		}
+	}
+	if err := SortAnswers(answers, "random"); err == nil {
+		t.Errorf("expected error for unknown sort")
+	}
+}
+
+func TestResolve_AnswerHashStable(t *testing.T) {
+	useDNSServers(t,
+		startTestDNSServer(t, "Second", staticHandler("example.com. 300 IN A 192.0.2.2", "example.com. 300 IN A 192.0.2.1")),
+		startTestDNSServer(t, "First", staticHandler("example.com. 60 IN A 192.0.2.1", "example.com. 60 IN A 192.0.2.2")),
+	)
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A", nil)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	var response LookupResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&response); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	if len(response.Answers) != 2 || response.Answers[0].DNSServer != "First" {
+		t.Fatalf("expected answers sorted by name, got %+v", response.Answers)
+	}
+	if response.Answers[0].AnswerHash != response.Answers[1].AnswerHash {
+		t.Errorf("expected equal answer hashes, got %+v", response.Answers)
+	}
+	if response.Answers[1].Values[0] != "192.0.2.1" {
+		t.Errorf("expected sorted values, got %v", response.Answers[1].Values)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A&sort=random", nil)
+	w = httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid sort, got %d", w.Code)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain is the number of hops after which a chain is reported as too long.
+const maxCNAMEChain = 10
+
+const (
+	ChainComplete   = "complete"
+	ChainLoop       = "loop"
+	ChainTooLong    = "too_long"
+	ChainNXDomain   = "nxdomain"
+	ChainNoData     = "nodata"
+	ChainIncomplete = "incomplete"
+)
+
+// CNAMEHop is one alias in a chain.
+type CNAMEHop struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	TTL    int    `json:"ttl"`
+	Chased bool   `json:"chased,omitempty"`
+}
+
+// CNAMEChain is the path from the question name through its aliases to the final RRset.
+type CNAMEChain struct {
+	Hops      []CNAMEHop  `json:"hops"`
+	FinalName string      `json:"final_name"`
+	Final     []RecordTTL `json:"final"`
+	Status    string      `json:"status"`
+}
+
+// BuildChain follows the CNAME records in msg starting from qname.
+func BuildChain(msg *dns.Msg, qname string, qtype uint16) *CNAMEChain {
+	chain := &CNAMEChain{Hops: []CNAMEHop{}, Final: []RecordTTL{}, FinalName: qname}
+	follow(chain, msg, qtype, false)
+	return chain
+}
+
+// follow extends chain with the aliases and final records found in msg.
+func follow(chain *CNAMEChain, msg *dns.Msg, qtype uint16, chased bool) {
+	aliases := map[string]*dns.CNAME{}
+	for _, rr := range msg.Answer {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			aliases[strings.ToLower(cname.Hdr.Name)] = cname
+		}
+	}
+	visited := map[string]bool{strings.ToLower(chain.FinalName): true}
+	for _, hop := range chain.Hops {
+		visited[strings.ToLower(hop.Name)] = true
+	}
+	for {
+		cname, ok := aliases[strings.ToLower(chain.FinalName)]
+		if !ok {
+			break
+		}
+		chain.Hops = append(chain.Hops, CNAMEHop{Name: cname.Hdr.Name, Target: cname.Target, TTL: int(cname.Hdr.Ttl), Chased: chased})
+		chain.FinalName = cname.Target
+		if visited[strings.ToLower(cname.Target)] {
+			chain.Status = ChainLoop
+			return
+		}
+		if len(chain.Hops) > maxCNAMEChain {
+			chain.Status = ChainTooLong
+			return
+		}
+		visited[strings.ToLower(cname.Target)] = true
+	}
+	for _, rr := range msg.Answer {
+		if strings.EqualFold(rr.Header().Name, chain.FinalName) && rr.Header().Rrtype == qtype {
+			chain.Final = append(chain.Final, RecordTTL{
+				Name:  rr.Header().Name,
+				Type:  dns.Type(rr.Header().Rrtype).String(),
+				TTL:   int(rr.Header().Ttl),
+				Value: RecordValue(rr),
+			})
+		}
+	}
+	switch {
+	case len(chain.Final) > 0:
+		chain.Status = ChainComplete
+	case msg.Rcode == dns.RcodeNameError:
+		chain.Status = ChainNXDomain
+	case hasSOA(msg.Ns):
+		chain.Status = ChainNoData
+	default:
+		chain.Status = ChainIncomplete
+	}
+}
+
+func hasSOA(section []dns.RR) bool {
+	for _, rr := range section {
+		if rr.Header().Rrtype == dns.TypeSOA {
+			return true
+		}
+	}
+	return false
+}
+
+// ChaseChain asks the server for the last target of an incomplete chain until it completes
+// or runs into a loop, the length limit or an error. rd is the recursion desired flag of the original question.
+func ChaseChain(ctx context.Context, client *dns.Client, server DNSServer, chain *CNAMEChain, qtype uint16, rd bool) {
+	client = serverClient(client, server)
+	for chain.Status == ChainIncomplete && len(chain.Hops) <= maxCNAMEChain {
+		m := new(dns.Msg)
+		m.SetQuestion(dns.Fqdn(chain.FinalName), qtype)
+		m.RecursionDesired = rd
+		resp, _, err := ExchangeContext(ctx, client, m, server.AddressString())
+		if err != nil {
+			return
+		}
+		hops := len(chain.Hops)
+		follow(chain, resp, qtype, true)
+		if chain.Status == ChainIncomplete && len(chain.Hops) == hops {
+			return
+		}
+	}
+}
+
+// AddChains attaches the CNAME chain to every answer that contains an alias, chasing incomplete chains when asked.
+func AddChains(ctx context.Context, client *dns.Client, answers []DNSServerResponse, parsed *ParsedQuestion) {
+	if parsed.Type == dns.TypeCNAME {
+		return
+	}
+	var wg sync.WaitGroup
+	for i := range answers {
+		if answers[i].msg == nil {
+			continue
+		}
+		chain := BuildChain(answers[i].msg, parsed.Domain, parsed.Type)
+		if len(chain.Hops) == 0 {
+			continue
+		}
+		answers[i].CNAMEChain = chain
+		if parsed.Chase && chain.Status == ChainIncomplete {
+			wg.Add(1)
+			go func(server DNSServer) {
+				defer wg.Done()
+				ChaseChain(ctx, client, server, chain, parsed.Type, parsed.RD)
+			}(answers[i].server)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func msgWith(t *testing.T, rcode int, records ...string) *dns.Msg {
+	t.Helper()
+	msg := &dns.Msg{MsgHdr: dns.MsgHdr{Rcode: rcode}}
+	for _, record := range records {
+		msg.Answer = append(msg.Answer, mustRR(t, record))
+	}
+	return msg
+}
+
+func TestBuildChain(t *testing.T) {
+	chain := BuildChain(msgWith(t, dns.RcodeSuccess,
+		"www.example.com. 3600 IN CNAME cdn.example.net.",
+		"cdn.example.net. 60 IN CNAME edge.example.org.",
+		"edge.example.org. 20 IN A 192.0.2.1",
+	), "www.example.com.", dns.TypeA)
+	if chain.Status != ChainComplete || len(chain.Hops) != 2 || chain.FinalName != "edge.example.org." {
+		t.Fatalf("unexpected chain %+v", chain)
+	}
+	if chain.Hops[1].TTL != 60 || len(chain.Final) != 1 || chain.Final[0].TTL != 20 {
+		t.Errorf("unexpected TTLs %+v", chain)
+	}
+
+	chain = BuildChain(msgWith(t, dns.RcodeSuccess,
+		"a.example.com. 300 IN CNAME b.example.com.",
+		"b.example.com. 300 IN CNAME a.example.com.",
+	), "a.example.com.", dns.TypeA)
+	if chain.Status != ChainLoop {
+		t.Errorf("expected loop, got %+v", chain)
+	}
+
+	chain = BuildChain(msgWith(t, dns.RcodeNameError, "www.example.com. 300 IN CNAME gone.example.com."), "www.example.com.", dns.TypeA)
+	if chain.Status != ChainNXDomain {
+		t.Errorf("expected nxdomain, got %+v", chain)
+	}
+
+	var long []string
+	for i := 0; i <= maxCNAMEChain+1; i++ {
+		long = append(long, fmt.Sprintf("h%d.example.com. 300 IN CNAME h%d.example.com.", i, i+1))
+	}
+	chain = BuildChain(msgWith(t, dns.RcodeSuccess, long...), "h0.example.com.", dns.TypeA)
+	if chain.Status != ChainTooLong {
+		t.Errorf("expected too_long, got %+v", chain)
+	}
+}
+
+func TestResolve_ChaseChain(t *testing.T) {
+	// The resolver only returns one hop at a time.
+	oneHop := zoneHandler(false,
+		"www.example.com. 300 IN CNAME cdn.example.net.",
+		"cdn.example.net. 60 IN A 192.0.2.1",
+	)
+	useDNSServers(t, startTestDNSServer(t, "Lazy", oneHop))
+
+	parsed, _ := ParseURLQuery(mustParseURL(t, "/lookup?domain=www.example.com.&type=A"))
+	chain := Lookup(context.Background(), NewClient(), parsed, dnsServers).Answers[0].CNAMEChain
+	if chain == nil || chain.Status != ChainIncomplete {
+		t.Fatalf("expected incomplete chain, got %+v", chain)
+	}
+
+	parsed, _ = ParseURLQuery(mustParseURL(t, "/lookup?domain=www.example.com.&type=A&chase=true"))
+	chain = Lookup(context.Background(), NewClient(), parsed, dnsServers).Answers[0].CNAMEChain
+	if chain == nil || chain.Status != ChainComplete || chain.Final[0].Value != "192.0.2.1" {
+		t.Errorf("expected chased chain to complete, got %+v", chain)
+	}
+}
+
+func TestResolve_ChainValues(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "Full", staticHandler(
+		"www.example.com. 300 IN CNAME cdn.example.net.",
+		"cdn.example.net. 60 IN A 192.0.2.1",
+	)))
+
+	parsed, _ := ParseURLQuery(mustParseURL(t, "/lookup?domain=www.example.com.&type=A"))
+	answer := Lookup(context.Background(), NewClient(), parsed, dnsServers).Answers[0]
+	if !slices.Equal(answer.Values, []string{"192.0.2.1"}) {
+		t.Errorf("Values = %v, want only the final address", answer.Values)
+	}
+	if len(answer.Records) != 2 || answer.CNAMEChain == nil || answer.CNAMEChain.Status != ChainComplete {
+		t.Errorf("Records = %v, CNAMEChain = %+v", answer.Records, answer.CNAMEChain)
+	}
+}
+
+func TestResolve_ChaseChainRD(t *testing.T) {
+	oneHop := zoneHandler(false,
+		"www.example.com. 300 IN CNAME cdn.example.net.",
+		"cdn.example.net. 60 IN A 192.0.2.1",
+	)
+	var chasedRD atomic.Bool
+	chasedRD.Store(true)
+	useDNSServers(t, startTestDNSServer(t, "Lazy", func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.Question[0].Name == "cdn.example.net." {
+			chasedRD.Store(r.RecursionDesired)
+		}
+		oneHop(w, r)
+	}))
+
+	parsed, _ := ParseURLQuery(mustParseURL(t, "/lookup?domain=www.example.com.&type=A&chase=true&rd=false"))
+	chain := Lookup(context.Background(), NewClient(), parsed, dnsServers).Answers[0].CNAMEChain
+	if chain == nil || chain.Status != ChainComplete {
+		t.Fatalf("expected chased chain to complete, got %+v", chain)
+	}
+	if chasedRD.Load() {
+		t.Error("the chase query set RD although the question did not")
+	}
+}
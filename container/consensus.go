@@ -0,0 +1,82 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+)
+
+const (
+	DisagreementNone        = "none"
+	DisagreementOrderingTTL = "ordering_or_ttl"
+	DisagreementData        = "data"
+)
+
+// AnswerGroup is a set of servers that returned the same canonical answer.
+type AnswerGroup struct {
+	AnswerHash string   `json:"answer_hash"`
+	Rcode      string   `json:"rcode"`
+	Values     []string `json:"values"`
+	Servers    []string `json:"servers"`
+}
+
+// Consensus summarises how much the servers agree with each other.
+type Consensus struct {
+	Groups           []AnswerGroup `json:"groups"`
+	MajorityHash     string        `json:"majority_hash"`
+	MajorityValues   []string      `json:"majority_values"`
+	Outliers         []string      `json:"outliers"`
+	AgreementPercent float64       `json:"agreement_percent"`
+	Disagreement     string        `json:"disagreement"`
+}
+
+// BuildConsensus groups the answers by answer hash. The largest group is the majority
+// and every server outside of it is an outlier. When all servers share a single group
+// but their raw answers still differ, the disagreement is only in record ordering or TTLs.
+func BuildConsensus(answers []DNSServerResponse) *Consensus {
+	consensus := &Consensus{
+		Groups:       []AnswerGroup{},
+		Outliers:     []string{},
+		Disagreement: DisagreementNone,
+	}
+	// Servers that lost every query have no answer to compare.
+	answers = slices.DeleteFunc(slices.Clone(answers), func(answer DNSServerResponse) bool { return answer.AnswerHash == "" })
+	if len(answers) == 0 {
+		return consensus
+	}
+	groups := map[string]*AnswerGroup{}
+	signatures := map[string]struct{}{}
+	for _, answer := range answers {
+		signatures[answer.rawSignature] = struct{}{}
+		group, ok := groups[answer.AnswerHash]
+		if !ok {
+			group = &AnswerGroup{AnswerHash: answer.AnswerHash, Rcode: answer.Rcode, Values: answer.Values}
+			groups[answer.AnswerHash] = group
+		}
+		group.Servers = append(group.Servers, answer.DNSServer)
+	}
+	for _, group := range groups {
+		slices.Sort(group.Servers)
+		consensus.Groups = append(consensus.Groups, *group)
+	}
+	slices.SortFunc(consensus.Groups, func(a, b AnswerGroup) int {
+		return cmp.Or(cmp.Compare(len(b.Servers), len(a.Servers)), cmp.Compare(a.AnswerHash, b.AnswerHash))
+	})
+
+	majority := consensus.Groups[0]
+	consensus.MajorityHash = majority.AnswerHash
+	consensus.MajorityValues = majority.Values
+	for _, group := range consensus.Groups[1:] {
+		consensus.Outliers = append(consensus.Outliers, group.Servers...)
+	}
+	slices.SortFunc(consensus.Outliers, strings.Compare)
+	consensus.AgreementPercent = math.Round(float64(len(majority.Servers))/float64(len(answers))*1000) / 10
+	switch {
+	case len(consensus.Groups) > 1:
+		consensus.Disagreement = DisagreementData
+	case len(signatures) > 1:
+		consensus.Disagreement = DisagreementOrderingTTL
+	}
+	return consensus
+}
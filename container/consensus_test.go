@@ -0,0 +1,68 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func answerFrom(t *testing.T, server string, records ...string) DNSServerResponse {
+	t.Helper()
+	msg := new(dns.Msg)
+	for _, record := range records {
+		msg.Answer = append(msg.Answer, mustRR(t, record))
+	}
+	answer := DNSServerResponse{DNSServer: server, Rcode: "NOERROR", rawSignature: RawSignature(msg)}
+	answer.AnswerHash = CanonicalizeAnswer(msg)
+	for _, rr := range msg.Answer {
+		answer.Values = append(answer.Values, RecordValue(rr))
+	}
+	return answer
+}
+
+func TestBuildConsensus_DataDisagreement(t *testing.T) {
+	consensus := BuildConsensus([]DNSServerResponse{
+		answerFrom(t, "a", "example.com. 300 IN A 192.0.2.1"),
+		answerFrom(t, "b", "example.com. 300 IN A 192.0.2.1"),
+		answerFrom(t, "c", "example.com. 300 IN A 192.0.2.1"),
+		answerFrom(t, "d", "example.com. 300 IN A 198.51.100.1"),
+	})
+	if len(consensus.Groups) != 2 || len(consensus.Groups[0].Servers) != 3 {
+		t.Fatalf("unexpected groups %+v", consensus.Groups)
+	}
+	if !slices.Equal(consensus.MajorityValues, []string{"192.0.2.1"}) {
+		t.Errorf("unexpected majority %v", consensus.MajorityValues)
+	}
+	if !slices.Equal(consensus.Outliers, []string{"d"}) {
+		t.Errorf("unexpected outliers %v", consensus.Outliers)
+	}
+	if consensus.AgreementPercent != 75 || consensus.Disagreement != DisagreementData {
+		t.Errorf("unexpected agreement %v / %s", consensus.AgreementPercent, consensus.Disagreement)
+	}
+}
+
+func TestBuildConsensus_OrderingAndTTL(t *testing.T) {
+	consensus := BuildConsensus([]DNSServerResponse{
+		answerFrom(t, "a", "example.com. 300 IN A 192.0.2.1", "example.com. 300 IN A 192.0.2.2"),
+		answerFrom(t, "b", "example.com. 120 IN A 192.0.2.2", "example.com. 120 IN A 192.0.2.1"),
+	})
+	if consensus.AgreementPercent != 100 || consensus.Disagreement != DisagreementOrderingTTL || len(consensus.Outliers) != 0 {
+		t.Errorf("unexpected consensus %+v", consensus)
+	}
+
+	consensus = BuildConsensus([]DNSServerResponse{
+		answerFrom(t, "a", "example.com. 300 IN A 192.0.2.1"),
+		answerFrom(t, "b", "example.com. 300 IN A 192.0.2.1"),
+	})
+	if consensus.Disagreement != DisagreementNone {
+		t.Errorf("expected no disagreement, got %s", consensus.Disagreement)
+	}
+}
+
+func TestBuildConsensus_Empty(t *testing.T) {
+	consensus := BuildConsensus(nil)
+	if consensus.AgreementPercent != 0 || len(consensus.Groups) != 0 {
+		t.Errorf("unexpected consensus %+v", consensus)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// clientCookieLength is the length in bytes of the client cookie, fixed by RFC 7873.
+const clientCookieLength = 8
+
+// CookieResult reports how a server handled the DNS cookie (RFC 7873) sent with the query.
+type CookieResult struct {
+	ClientCookie string `json:"client_cookie"`
+	ServerCookie string `json:"server_cookie,omitempty"`
+	// Supported is set when the server returned a server cookie along with our client cookie.
+	Supported bool `json:"supported"`
+	// ClientCookieMismatch is set when the server echoed a different client cookie.
+	ClientCookieMismatch bool `json:"client_cookie_mismatch,omitempty"`
+	// BadCookie is set when the server answered BADCOOKIE, Retried when the query was then resent
+	// with the new server cookie as described in RFC 7873 section 5.3.
+	BadCookie bool `json:"badcookie,omitempty"`
+	Retried   bool `json:"retried,omitempty"`
+}
+
+type serverCookies struct {
+	client []byte
+	server string
+}
+
+// CookieJar keeps the client cookie and the last server cookie of every server, keyed by address.
+type CookieJar struct {
+	mu      sync.Mutex
+	servers map[string]*serverCookies
+}
+
+// cookieJar is shared by every lookup so servers see the same client cookie across requests.
+var cookieJar = NewCookieJar()
+
+func NewCookieJar() *CookieJar {
+	return &CookieJar{servers: map[string]*serverCookies{}}
+}
+
+// Cookie returns the hex encoded cookie to send to address, the client cookie followed by the cached server cookie.
+// A random client cookie is generated on first use.
+func (j *CookieJar) Cookie(address string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	cookies, ok := j.servers[address]
+	if !ok {
+		cookies = &serverCookies{client: make([]byte, clientCookieLength)}
+		_, _ = rand.Read(cookies.client)
+		j.servers[address] = cookies
+	}
+	return hex.EncodeToString(cookies.client) + cookies.server
+}
+
+// Update records the cookie returned by address, the server cookie is only kept when the client cookie matches ours.
+// The returned result describes the returned cookie.
+func (j *CookieJar) Update(address string, resp *dns.Msg) CookieResult {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	result := CookieResult{BadCookie: resp.Rcode == dns.RcodeBadCookie}
+	cookies, ok := j.servers[address]
+	if !ok {
+		return result
+	}
+	result.ClientCookie = hex.EncodeToString(cookies.client)
+	returned := ResponseCookie(resp)
+	if returned == "" {
+		return result
+	}
+	if !strings.EqualFold(returned[:min(len(returned), 2*clientCookieLength)], result.ClientCookie) {
+		result.ClientCookieMismatch = true
+		return result
+	}
+	if server := returned[2*clientCookieLength:]; server != "" {
+		cookies.server = server
+		result.ServerCookie = server
+		result.Supported = true
+	}
+	return result
+}
+
+// ResponseCookie returns the hex encoded cookie option of msg, or "" when it has none.
+func ResponseCookie(msg *dns.Msg) string {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, option := range opt.Option {
+		if cookie, ok := option.(*dns.EDNS0_COOKIE); ok {
+			return cookie.Cookie
+		}
+	}
+	return ""
+}
+
+// hasCookie reports whether the query asks for a cookie to be sent.
+func hasCookie(m *dns.Msg) bool {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, option := range opt.Option {
+		if option.Option() == dns.EDNS0COOKIE {
+			return true
+		}
+	}
+	return false
+}
+
+// withCookie returns a copy of m with its cookie option set to cookie.
+func withCookie(m *dns.Msg, cookie string) *dns.Msg {
+	m = m.Copy()
+	opt := m.IsEdns0()
+	for i, option := range opt.Option {
+		if option.Option() == dns.EDNS0COOKIE {
+			opt.Option[i] = &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: cookie}
+		}
+	}
+	return m
+}
+
+// ExchangeCookie sends m to server with the cookies from jar. A BADCOOKIE answer that came with a
+// new server cookie is retried once with that cookie. The returned duration covers both queries.
+func ExchangeCookie(ctx context.Context, client *dns.Client, jar *CookieJar, m *dns.Msg, server DNSServer) (*dns.Msg, time.Duration, *CookieResult, error) {
+	address := server.AddressString()
+	resp, duration, err := ExchangeContext(ctx, client, withCookie(m, jar.Cookie(address)), address)
+	if err != nil {
+		return nil, duration, nil, err
+	}
+	result := jar.Update(address, resp)
+	if result.BadCookie && result.Supported {
+		var retry time.Duration
+		resp, retry, err = ExchangeContext(ctx, client, withCookie(m, jar.Cookie(address)), address)
+		duration += retry
+		if err != nil {
+			return nil, duration, nil, err
+		}
+		retried := jar.Update(address, resp)
+		retried.BadCookie, retried.Retried = true, true
+		result = retried
+	}
+	return resp, duration, &result, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const testServerCookie = "0102030405060708"
+
+// cookieHandler answers BADCOOKIE until the query carries its server cookie, like a server enforcing cookies.
+func cookieHandler(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.SetEdns0(4096, false)
+	client := ResponseCookie(r)
+	if len(client) < 2*clientCookieLength {
+		m.Rcode = dns.RcodeFormatError
+		_ = w.WriteMsg(m)
+		return
+	}
+	if client[2*clientCookieLength:] != testServerCookie {
+		m.Rcode = dns.RcodeBadCookie
+	} else {
+		m.Answer = append(m.Answer, parseRRs([]string{r.Question[0].Name + " 300 IN A 192.0.2.1"})...)
+	}
+	opt := m.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: client[:2*clientCookieLength] + testServerCookie})
+	_ = w.WriteMsg(m)
+}
+
+func TestExchangeCookie_BadCookieRetry(t *testing.T) {
+	server := startTestDNSServer(t, "cookies", cookieHandler)
+	jar := NewCookieJar()
+	m := NewQuestionMsg(&ParsedQuestion{Domain: "example.com.", Type: dns.TypeA, RD: true, Cookies: true})
+
+	resp, _, result, err := ExchangeCookie(context.Background(), NewClient(), jar, m, server)
+	if err != nil {
+		t.Fatalf("ExchangeCookie() error = %v", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("response = %v, want the answer of the retried query", resp)
+	}
+	if !result.Supported || !result.BadCookie || !result.Retried || result.ServerCookie != testServerCookie {
+		t.Errorf("result = %+v", result)
+	}
+
+	_, _, result, err = ExchangeCookie(context.Background(), NewClient(), jar, m, server)
+	if err != nil {
+		t.Fatalf("ExchangeCookie() error = %v", err)
+	}
+	if result.BadCookie || result.Retried || !result.Supported {
+		t.Errorf("result = %+v, want the cached server cookie to be accepted", result)
+	}
+}
+
+func TestResolve_Cookies(t *testing.T) {
+	useDNSServers(t,
+		startTestDNSServer(t, "cookies", cookieHandler),
+		startTestDNSServer(t, "plain", staticHandler("example.com. 300 IN A 192.0.2.1")))
+
+	req := httptest.NewRequest(http.MethodGet, "/lookup?domain=example.com&type=A&cookies=true", nil)
+	rr := httptest.NewRecorder()
+	ResolveEndpoint(rr, req)
+	var response LookupResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid JSON: %v, body %s", err, rr.Body.String())
+	}
+	if len(response.Answers) != 2 {
+		t.Fatalf("Answers = %+v", response.Answers)
+	}
+	for _, answer := range response.Answers {
+		if answer.Cookie == nil || len(answer.Cookie.ClientCookie) != 2*clientCookieLength {
+			t.Fatalf("%s: Cookie = %+v", answer.DNSServer, answer.Cookie)
+		}
+		if supported := answer.DNSServer == "cookies"; answer.Cookie.Supported != supported {
+			t.Errorf("%s: Supported = %v, want %v", answer.DNSServer, answer.Cookie.Supported, supported)
+		}
+	}
+}
+
+func TestCookieJar_ClientCookieMismatch(t *testing.T) {
+	jar := NewCookieJar()
+	jar.Cookie("192.0.2.53:53")
+	resp := new(dns.Msg)
+	resp.SetEdns0(4096, false)
+	opt := resp.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "ffffffffffffffff" + testServerCookie})
+	if result := jar.Update("192.0.2.53:53", resp); !result.ClientCookieMismatch || result.Supported {
+		t.Errorf("result = %+v, want a mismatch", result)
+	}
+	if cookie := jar.Cookie("192.0.2.53:53"); len(cookie) != 2*clientCookieLength {
+		t.Errorf("Cookie() = %s, want the mismatched server cookie to be dropped", cookie)
+	}
+}
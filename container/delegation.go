@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// NameserverCheck is the result of querying a single authoritative address directly.
+type NameserverCheck struct {
+	Name           string        `json:"name"`
+	Address        string        `json:"address"`
+	InParent       bool          `json:"in_parent"`
+	InChild        bool          `json:"in_child"`
+	Authoritative  bool          `json:"authoritative"`
+	Lame           bool          `json:"lame"`
+	Unreachable    bool          `json:"unreachable,omitempty"`
+	Rcode          string        `json:"rcode,omitempty"`
+	Serial         *uint32       `json:"serial,omitempty"`
+	NS             []string      `json:"ns,omitempty"`
+	Values         []string      `json:"values"`
+	InSync         bool          `json:"in_sync"`
+	Error          string        `json:"error,omitempty"`
+	Incomplete     bool          `json:"incomplete,omitempty"`
+	Duration       time.Duration `json:"duration"`
+	DurationString string        `json:"duration_string"`
+}
+
+// delegationTimeout caps a delegation check when the request has no deadline_ms.
+const delegationTimeout = 15 * time.Second
+
+// DelegationReport compares the delegation in the parent with what the zone's own servers answer.
+type DelegationReport struct {
+	Question       string            `json:"question"`
+	Type           string            `json:"type"`
+	Zone           string            `json:"zone"`
+	ParentZone     string            `json:"parent_zone"`
+	ParentServer   string            `json:"parent_server"`
+	ParentNS       []string          `json:"parent_ns"`
+	ChildNS        []string          `json:"child_ns"`
+	NSMatch        bool              `json:"ns_match"`
+	OnlyInParent   []string          `json:"only_in_parent,omitempty"`
+	OnlyInChild    []string          `json:"only_in_child,omitempty"`
+	MissingGlue    []string          `json:"missing_glue,omitempty"`
+	Serial         uint32            `json:"serial"`
+	SerialsInSync  bool              `json:"serials_in_sync"`
+	RRsetInSync    bool              `json:"rrset_in_sync"`
+	Lame           []string          `json:"lame,omitempty"`
+	Unreachable    []string          `json:"unreachable,omitempty"`
+	OutOfSync      []string          `json:"out_of_sync,omitempty"`
+	Incomplete     []string          `json:"incomplete,omitempty"`
+	Nameservers    []NameserverCheck `json:"nameservers"`
+	Duration       time.Duration     `json:"duration"`
+	DurationString string            `json:"duration_string"`
+}
+
+// parentZone returns the zone one label above zone.
+func parentZone(zone string) string {
+	next, end := dns.NextLabel(zone, 0)
+	if end {
+		return "."
+	}
+	return zone[next:]
+}
+
+// ParentDelegation asks the parent's servers for the NS records of zone and returns the referral.
+func ParentDelegation(ctx context.Context, client *dns.Client, resolver DNSServer, zone string) (*dns.Msg, DNSServer, string, error) {
+	if zone == "." {
+		return nil, DNSServer{}, "", fmt.Errorf("the root zone has no parent")
+	}
+	parent, err := FindZone(ctx, client, resolver, parentZone(zone))
+	if err != nil {
+		return nil, DNSServer{}, "", err
+	}
+	servers, err := AuthoritativeServers(ctx, client, resolver, parent)
+	if err != nil {
+		return nil, DNSServer{}, "", err
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(zone, dns.TypeNS)
+	m.RecursionDesired = false
+	var lastErr error
+	for _, server := range servers {
+		resp, _, err := ExchangeContext(ctx, client, m, server.AddressString())
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(nsNames(resp, zone)) == 0 {
+			lastErr = fmt.Errorf("%s returned no delegation for %s", server.Name, zone)
+			continue
+		}
+		return resp, server, parent, nil
+	}
+	return nil, DNSServer{}, parent, lastErr
+}
+
+// nsNames returns the sorted nameserver names for zone found in the answer or authority section.
+func nsNames(msg *dns.Msg, zone string) []string {
+	names := []string{}
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range section {
+			if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, zone) {
+				names = append(names, strings.ToLower(ns.Ns))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// hostAddresses returns the IPv4 and IPv6 addresses of host from glue, the resolver is only asked
+// when the referral has no glue for host.
+func hostAddresses(ctx context.Context, client *dns.Client, resolver DNSServer, host string, glue []dns.RR) []string {
+	var addresses []string
+	for _, rr := range glue {
+		if !strings.EqualFold(rr.Header().Name, host) {
+			continue
+		}
+		switch v := rr.(type) {
+		case *dns.A:
+			addresses = append(addresses, v.A.String())
+		case *dns.AAAA:
+			addresses = append(addresses, v.AAAA.String())
+		}
+	}
+	if len(addresses) > 0 {
+		slices.Sort(addresses)
+		return slices.Compact(addresses)
+	}
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		m := new(dns.Msg)
+		m.SetQuestion(dns.Fqdn(host), qtype)
+		m.RecursionDesired = true
+		resp, _, err := ExchangeContext(ctx, client, m, resolver.AddressString())
+		if err != nil {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			switch v := rr.(type) {
+			case *dns.A:
+				addresses = append(addresses, v.A.String())
+			case *dns.AAAA:
+				addresses = append(addresses, v.AAAA.String())
+			}
+		}
+	}
+	slices.Sort(addresses)
+	return slices.Compact(addresses)
+}
+
+// hasGlue reports whether the referral carries an address record for host.
+func hasGlue(extra []dns.RR, host string) bool {
+	for _, rr := range extra {
+		switch rr.Header().Rrtype {
+		case dns.TypeA, dns.TypeAAAA:
+			if strings.EqualFold(rr.Header().Name, host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckNameserver queries a single address for the zone SOA and NS and for the question with RD=0.
+// An address that has not answered when ctx expires is marked incomplete rather than lame.
+func CheckNameserver(ctx context.Context, client *dns.Client, server DNSServer, zone, name string, qtype uint16) NameserverCheck {
+	check := NameserverCheck{Name: server.Name, Address: server.Address, Values: []string{}}
+	start := time.Now()
+	defer func() {
+		check.Duration = time.Since(start)
+		check.DurationString = check.Duration.String()
+	}()
+	query := func(qname string, t uint16) (*dns.Msg, error) {
+		m := new(dns.Msg)
+		m.SetQuestion(qname, t)
+		m.RecursionDesired = false
+		resp, _, err := ExchangeContext(ctx, client, m, server.AddressString())
+		return resp, err
+	}
+
+	soa, err := query(zone, dns.TypeSOA)
+	if err != nil && contextExpired(ctx) {
+		check.Incomplete, check.Error = true, err.Error()
+		return check
+	}
+	// A transport error says nothing about the server's zone data, only replies can make it lame.
+	if err != nil {
+		check.Unreachable, check.Error = true, err.Error()
+		return check
+	}
+	check.Rcode = dns.RcodeToString[soa.Rcode]
+	check.Authoritative = soa.Authoritative
+	if !soa.Authoritative || soa.Rcode != dns.RcodeSuccess {
+		check.Lame = true
+		check.Error = fmt.Sprintf("not authoritative for %s", zone)
+		return check
+	}
+	for _, rr := range soa.Answer {
+		if s, ok := rr.(*dns.SOA); ok {
+			check.Serial = &s.Serial
+		}
+	}
+	if ns, err := query(zone, dns.TypeNS); err == nil {
+		check.NS = nsNames(ns, zone)
+	}
+	answer, err := query(name, qtype)
+	if err != nil {
+		check.Incomplete = contextExpired(ctx)
+		check.Error = err.Error()
+		return check
+	}
+	check.Values = finalValues(answer, qtype)
+	return check
+}
+
+// checkHost checks every address of the nameserver host concurrently.
+func checkHost(ctx context.Context, client *dns.Client, resolver DNSServer, host string, glue []dns.RR, zone, name string, qtype uint16) []NameserverCheck {
+	addresses := hostAddresses(ctx, client, resolver, host, glue)
+	if len(addresses) == 0 {
+		check := NameserverCheck{Name: host, Values: []string{}}
+		if contextExpired(ctx) {
+			check.Incomplete, check.Error = true, "deadline expired before the addresses were found"
+		} else {
+			check.Lame, check.Error = true, "no addresses found"
+		}
+		return []NameserverCheck{check}
+	}
+	checks := make([]NameserverCheck, len(addresses))
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			server := DNSServer{Name: host, Address: address, Port: authoritativePort}
+			checks[i] = CheckNameserver(ctx, client, server, zone, name, qtype)
+		}(i, address)
+	}
+	wg.Wait()
+	return checks
+}
+
+// CheckDelegation compares the parent and child NS sets and queries every authoritative address for name.
+// The nameservers are checked concurrently, those that have not answered when ctx expires are listed as incomplete.
+func CheckDelegation(ctx context.Context, client *dns.Client, resolver DNSServer, name string, qtype uint16) (*DelegationReport, error) {
+	start := time.Now()
+	name = dns.Fqdn(name)
+	zone, err := FindZone(ctx, client, resolver, name)
+	if err != nil {
+		return nil, err
+	}
+	referral, parentServer, parent, err := ParentDelegation(ctx, client, resolver, zone)
+	if err != nil {
+		return nil, err
+	}
+	report := &DelegationReport{
+		Question:     name,
+		Type:         dns.Type(qtype).String(),
+		Zone:         zone,
+		ParentZone:   parent,
+		ParentServer: parentServer.String(),
+		ParentNS:     nsNames(referral, zone),
+		ChildNS:      []string{},
+		Nameservers:  []NameserverCheck{},
+	}
+	for _, ns := range report.ParentNS {
+		if dns.IsSubDomain(zone, ns) && !hasGlue(referral.Extra, ns) {
+			report.MissingGlue = append(report.MissingGlue, ns)
+		}
+	}
+
+	checks := func(names []string, seen map[string]bool) {
+		var hosts []string
+		for _, ns := range names {
+			if !seen[ns] {
+				seen[ns] = true
+				hosts = append(hosts, ns)
+			}
+		}
+		results := make([][]NameserverCheck, len(hosts))
+		var wg sync.WaitGroup
+		for i, ns := range hosts {
+			wg.Add(1)
+			go func(i int, ns string) {
+				defer wg.Done()
+				results[i] = checkHost(ctx, client, resolver, ns, referral.Extra, zone, name, qtype)
+			}(i, ns)
+		}
+		wg.Wait()
+		for _, result := range results {
+			report.Nameservers = append(report.Nameservers, result...)
+		}
+	}
+	seen := map[string]bool{}
+	checks(report.ParentNS, seen)
+	for _, check := range report.Nameservers {
+		if check.Authoritative && len(check.NS) > 0 {
+			report.ChildNS = check.NS
+			break
+		}
+	}
+	checks(report.ChildNS, seen)
+
+	report.NSMatch = slices.Equal(report.ParentNS, report.ChildNS)
+	for _, ns := range report.ParentNS {
+		if !slices.Contains(report.ChildNS, ns) {
+			report.OnlyInParent = append(report.OnlyInParent, ns)
+		}
+	}
+	for _, ns := range report.ChildNS {
+		if !slices.Contains(report.ParentNS, ns) {
+			report.OnlyInChild = append(report.OnlyInChild, ns)
+		}
+	}
+
+	valueCounts := map[string]int{}
+	for _, check := range report.Nameservers {
+		if check.Serial != nil {
+			report.Serial = max(report.Serial, *check.Serial)
+			valueCounts[strings.Join(check.Values, "\n")]++
+		}
+	}
+	majority, best := "", 0
+	for values, count := range valueCounts {
+		if count > best || (count == best && values < majority) {
+			majority, best = values, count
+		}
+	}
+	report.SerialsInSync, report.RRsetInSync = true, len(valueCounts) <= 1
+	for i := range report.Nameservers {
+		check := &report.Nameservers[i]
+		check.InParent = slices.Contains(report.ParentNS, check.Name)
+		check.InChild = slices.Contains(report.ChildNS, check.Name)
+		label := check.Name
+		if check.Address != "" {
+			label = fmt.Sprintf("%s (%s)", check.Name, check.Address)
+		}
+		if check.Incomplete {
+			report.Incomplete = append(report.Incomplete, label)
+			continue
+		}
+		if check.Lame {
+			report.Lame = append(report.Lame, label)
+			continue
+		}
+		if check.Unreachable {
+			report.Unreachable = append(report.Unreachable, label)
+			continue
+		}
+		if check.Serial == nil {
+			continue
+		}
+		check.InSync = *check.Serial == report.Serial && strings.Join(check.Values, "\n") == majority
+		if *check.Serial != report.Serial {
+			report.SerialsInSync = false
+		}
+		if !check.InSync {
+			report.OutOfSync = append(report.OutOfSync, label)
+		}
+	}
+	report.Duration = time.Since(start)
+	report.DurationString = report.Duration.String()
+	return report, nil
+}
+
+// DelegationEndpoint reports lame delegations, NS mismatches, missing glue and out of sync nameservers.
+func DelegationEndpoint(w http.ResponseWriter, r *http.Request) {
+	parsed, err := ParseURLQuery(r.URL)
+	if err != nil {
+		QueryErrorResponse(w, err)
+		return
+	}
+	if len(dnsServers) == 0 {
+		ErrorJSONResponse(w, http.StatusInternalServerError, ErrNoServers, "No DNS servers configured")
+		return
+	}
+	timeout := delegationTimeout
+	if parsed.Deadline > 0 {
+		timeout = parsed.Deadline
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	report, err := CheckDelegation(ctx, NewClient(), dnsServers[0], parsed.Domain, parsed.Type)
+	if err != nil {
+		log.Printf("Error checking delegation for %s: %v", parsed.Domain, err)
+		ErrorJSONResponse(w, http.StatusBadGateway, ErrUpstream, fmt.Sprintf("Unable to check delegation: %v", err))
+		return
+	}
+	JSONResponse(w, report)
+}
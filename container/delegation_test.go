@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startDelegationHierarchy runs a resolver, a parent server and three child servers for example.test.
+// ns2 has no glue and an old serial, ns3 is only listed in the parent and is lame.
+func startDelegationHierarchy(t *testing.T) DNSServer {
+	t.Helper()
+	resolver := startTestDNSServer(t, "resolver", zoneHandler(false,
+		"example.test. 300 IN SOA ns1.example.test. hostmaster.example.test. 2 7200 3600 1209600 300",
+		"test. 300 IN SOA ns.nic.test. hostmaster.nic.test. 1 7200 3600 1209600 300",
+		"test. 300 IN NS ns.nic.test.",
+		"ns.nic.test. 300 IN A 127.0.0.2",
+		"ns1.example.test. 300 IN A 127.0.0.3",
+		"ns2.example.test. 300 IN A 127.0.0.4",
+		"ns3.example.test. 300 IN A 127.0.0.5",
+	))
+	if resolver.Address != "127.0.0.1" {
+		t.Skip("loopback address unavailable")
+	}
+	startTestDNSServerAt(t, "ns.nic.test.", "127.0.0.2", resolver.Port, referralHandler(
+		[]string{
+			"example.test. 86400 IN NS ns1.example.test.",
+			"example.test. 86400 IN NS ns2.example.test.",
+			"example.test. 86400 IN NS ns3.example.test.",
+		},
+		[]string{
+			"ns1.example.test. 86400 IN A 127.0.0.3",
+			"ns3.example.test. 86400 IN A 127.0.0.5",
+		},
+	))
+	child := func(serial, address string) dns.HandlerFunc {
+		return zoneHandler(true,
+			"example.test. 300 IN SOA ns1.example.test. hostmaster.example.test. "+serial+" 7200 3600 1209600 300",
+			"example.test. 300 IN NS ns1.example.test.",
+			"example.test. 300 IN NS ns2.example.test.",
+			"www.example.test. 300 IN A "+address,
+		)
+	}
+	startTestDNSServerAt(t, "ns1.example.test.", "127.0.0.3", resolver.Port, child("2", "192.0.2.1"))
+	startTestDNSServerAt(t, "ns2.example.test.", "127.0.0.4", resolver.Port, child("1", "192.0.2.99"))
+	startTestDNSServerAt(t, "ns3.example.test.", "127.0.0.5", resolver.Port, zoneHandler(false))
+
+	origPort := authoritativePort
+	authoritativePort = resolver.Port
+	t.Cleanup(func() { authoritativePort = origPort })
+	return resolver
+}
+
+func TestCheckDelegation(t *testing.T) {
+	resolver := startDelegationHierarchy(t)
+
+	report, err := CheckDelegation(context.Background(), NewClient(), resolver, "www.example.test", dns.TypeA)
+	if err != nil {
+		t.Fatalf("CheckDelegation() error = %v", err)
+	}
+	if report.Zone != "example.test." || report.ParentZone != "test." {
+		t.Errorf("zone = %q, parent = %q", report.Zone, report.ParentZone)
+	}
+	if report.NSMatch || !slices.Equal(report.OnlyInParent, []string{"ns3.example.test."}) || len(report.OnlyInChild) != 0 {
+		t.Errorf("NS comparison = match %v, parent only %v, child only %v", report.NSMatch, report.OnlyInParent, report.OnlyInChild)
+	}
+	if !slices.Equal(report.MissingGlue, []string{"ns2.example.test."}) {
+		t.Errorf("MissingGlue = %v", report.MissingGlue)
+	}
+	if !slices.Equal(report.Lame, []string{"ns3.example.test. (127.0.0.5)"}) {
+		t.Errorf("Lame = %v", report.Lame)
+	}
+	if report.Serial != 2 || report.SerialsInSync || report.RRsetInSync {
+		t.Errorf("serial = %d, serials in sync %v, rrset in sync %v", report.Serial, report.SerialsInSync, report.RRsetInSync)
+	}
+	if !slices.Equal(report.OutOfSync, []string{"ns2.example.test. (127.0.0.4)"}) {
+		t.Errorf("OutOfSync = %v", report.OutOfSync)
+	}
+	if len(report.Nameservers) != 3 {
+		t.Fatalf("got %d nameserver checks, want 3", len(report.Nameservers))
+	}
+	ns1 := report.Nameservers[0]
+	if !ns1.InSync || !ns1.InParent || !ns1.InChild || !slices.Equal(ns1.Values, []string{"192.0.2.1"}) {
+		t.Errorf("ns1 = %+v", ns1)
+	}
+}
+
+func TestParentZone(t *testing.T) {
+	tests := map[string]string{
+		"example.com.":     "com.",
+		"www.example.com.": "example.com.",
+		"com.":             ".",
+	}
+	for zone, want := range tests {
+		if got := parentZone(zone); got != want {
+			t.Errorf("parentZone(%q) = %q, want %q", zone, got, want)
+		}
+	}
+}
+
+func TestDelegationEndpoint(t *testing.T) {
+	resolver := startDelegationHierarchy(t)
+	useDNSServers(t, resolver)
+
+	req := httptest.NewRequest(http.MethodGet, "/delegation?domain=www.example.test&type=A", nil)
+	rr := httptest.NewRecorder()
+	DelegationEndpoint(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var report DelegationReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if report.Zone != "example.test." || len(report.Nameservers) != 3 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestDelegationEndpoint_Unreachable(t *testing.T) {
+	dead := startTestDNSServer(t, "dead", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		_ = w.WriteMsg(m)
+	})
+	useDNSServers(t, dead)
+
+	req := httptest.NewRequest(http.MethodGet, "/delegation?domain=example.test&type=A", nil)
+	rr := httptest.NewRecorder()
+	DelegationEndpoint(rr, req)
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", rr.Code)
+	}
+}
+
+func TestHostAddresses_Glue(t *testing.T) {
+	var queries atomic.Int32
+	resolver := startTestDNSServer(t, "resolver", func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		staticHandler("ns2.example.test. 300 IN A 192.0.2.2")(w, r)
+	})
+	glue := parseRRs([]string{"ns1.example.test. 86400 IN A 192.0.2.1"})
+
+	if got := hostAddresses(context.Background(), NewClient(), resolver, "ns1.example.test.", glue); !slices.Equal(got, []string{"192.0.2.1"}) {
+		t.Errorf("glued addresses = %v", got)
+	}
+	if n := queries.Load(); n != 0 {
+		t.Errorf("the resolver was asked %d times for a glued host", n)
+	}
+	if got := hostAddresses(context.Background(), NewClient(), resolver, "ns2.example.test.", glue); !slices.Equal(got, []string{"192.0.2.2"}) {
+		t.Errorf("resolved addresses = %v", got)
+	}
+}
+
+func TestCheckNameserver_Deadline(t *testing.T) {
+	slow := startTestDNSServer(t, "slow", slowHandler(time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	check := CheckNameserver(ctx, NewClient(), slow, "example.com.", "example.com.", dns.TypeA)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("CheckNameserver() took %v, want it to stop at the deadline", elapsed)
+	}
+	if !check.Incomplete || check.Lame {
+		t.Errorf("check = %+v, want incomplete and not lame", check)
+	}
+}
+
+func TestCheckNameserver_Unreachable(t *testing.T) {
+	closed := DNSServer{Name: "closed", Address: "127.0.0.1", Port: 1}
+	client := NewClient()
+	client.Timeout = 500 * time.Millisecond
+
+	check := CheckNameserver(context.Background(), client, closed, "example.com.", "example.com.", dns.TypeA)
+	if !check.Unreachable || check.Lame || check.Error == "" {
+		t.Errorf("check = %+v, want unreachable and not lame", check)
+	}
+}
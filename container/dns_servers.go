@@ -3,27 +3,77 @@ package main
 import (
 	"fmt"
 	"time"
+
+	"github.com/miekg/dns"
 )
 
 type DNSServer struct {
 	Name    string
 	Address string
 	Port    int
+	// TLSName is the name in the certificate of a server that answers DNS over TLS on TLSPort.
+	TLSName string `json:",omitempty"`
+	TLSPort int    `json:",omitempty"`
 }
 
 type DNSServerResponse struct {
-	DNSServer      string        `json:"server"`
-	Values         []string      `json:"values"`
-	Address        string        `json:"server_address"`
-	TTL            int           `json:"ttl"`
+	DNSServer             string        `json:"server"`
+	Values                []string      `json:"values"`
+	Address               string        `json:"server_address"`
+	Rcode                 string        `json:"rcode"`
+	TTL                   int           `json:"ttl"`
+	Records               []RecordTTL   `json:"records"`
+	TTLAnomaly            string        `json:"ttl_anomaly,omitempty"`
+	TTLAnomalyReason      string        `json:"ttl_anomaly_reason,omitempty"`
+	Propagation           string        `json:"propagation,omitempty"`
+	PropagationETA        *int          `json:"propagation_eta_seconds,omitempty"`
+	SuspectedManipulation *bool         `json:"suspected_manipulation,omitempty"`
+	ManipulationVerdict   string        `json:"manipulation_verdict,omitempty"`
+	ManipulationReason    string        `json:"manipulation_reason,omitempty"`
+	DNSSEC                *DNSSECResult `json:"dnssec,omitempty"`
+	Geo                   []GeoInfo     `json:"geo,omitempty"`
+	ServerGeo             *GeoInfo      `json:"server_geo,omitempty"`
+	Latency               *LatencyStats `json:"latency,omitempty"`
+	CNAMEChain            *CNAMEChain   `json:"cname_chain,omitempty"`
+	ECSScope              *int          `json:"ecs_scope,omitempty"`
+	FCrDNS                *FCrDNSResult `json:"fcrdns,omitempty"`
+	Cookie                *CookieResult `json:"cookie,omitempty"`
+	// Padded is set when the server padded its answer to an encrypted query.
+	Padded         bool          `json:"padded,omitempty"`
 	Duration       time.Duration `json:"duration"`
 	DurationString string        `json:"duration_string"`
+	AnswerHash     string        `json:"answer_hash"`
+	// Incomplete is set when the request was cancelled or its deadline expired before the server answered.
+	Incomplete bool `json:"incomplete,omitempty"`
+
+	// server and msg are kept for the non-JSON output formats.
+	server DNSServer
+	msg    *dns.Msg
+	// rawSignature is the answer before canonicalisation, used to spot ordering and TTL differences.
+	rawSignature string
+}
+
+// QueryFlags are the flags that were set on the query sent to every server.
+type QueryFlags struct {
+	RD bool `json:"rd"`
+	DO bool `json:"do"`
+	CD bool `json:"cd"`
+	AD bool `json:"ad"`
 }
 
 type LookupResponse struct {
 	Question            string              `json:"question"`
 	Type                string              `json:"type"`
+	IDN                 *IDNInfo            `json:"idn,omitempty"`
 	Answers             []DNSServerResponse `json:"answers"`
+	Incomplete          []string            `json:"incomplete,omitempty"`
+	AuthoritativeTTL    *int                `json:"authoritative_ttl,omitempty"`
+	Consensus           *Consensus          `json:"consensus,omitempty"`
+	Propagation         *PropagationSummary `json:"propagation,omitempty"`
+	GeoSummary          []GeoGroup          `json:"geo_summary,omitempty"`
+	ECS                 string              `json:"ecs,omitempty"`
+	Transport           string              `json:"transport,omitempty"`
+	Flags               QueryFlags          `json:"query_flags"`
 	Location            string              `json:"location"`
 	Region              string              `json:"region"`
 	Country             string              `json:"country"`
@@ -43,11 +93,15 @@ var dnsServers = []DNSServer{
 		Name:    "Cloudflare",
 		Address: "1.1.1.1",
 		Port:    53,
+		TLSName: "cloudflare-dns.com",
+		TLSPort: 853,
 	},
 	{
 		Name:    "Google",
 		Address: "8.8.8.8",
 		Port:    53,
+		TLSName: "dns.google",
+		TLSPort: 853,
 	},
 	{
 		Name:    "OpenDNS",
@@ -58,6 +112,8 @@ var dnsServers = []DNSServer{
 		Name:    "Quad9",
 		Address: "9.9.9.9",
 		Port:    53,
+		TLSName: "dns.quad9.net",
+		TLSPort: 853,
 	},
 	{
 		Name:    "Oracle",
@@ -175,7 +231,7 @@ var dnsServers = []DNSServer{
 		Port:    53,
 	},
 	{
-		Name:  "Comcast Xfinity DNS Servers",
+		Name:    "Comcast Xfinity DNS Servers",
 		Address: "75.75.75.75",
 		Port:    53,
 	},
@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"net"
+	"strings"
 	"testing"
+
+	"github.com/miekg/dns"
 )
 
 func TestDNSServer_String(t *testing.T) {
@@ -30,3 +34,84 @@ func TestDNSServer_AddressString(t *testing.T) {
 		t.Errorf("AddressString() = %q, want %q", result, expected)
 	}
 }
+
+// startTestDNSServer runs an in-process UDP DNS server answering with handler.
+func startTestDNSServer(t *testing.T, name string, handler dns.HandlerFunc) DNSServer {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+	addr := pc.LocalAddr().(*net.UDPAddr)
+	return DNSServer{Name: name, Address: addr.IP.String(), Port: addr.Port}
+}
+
+// useDNSServers replaces the resolver list for the duration of the test.
+func useDNSServers(t *testing.T, servers ...DNSServer) {
+	t.Helper()
+	orig := dnsServers
+	dnsServers = servers
+	t.Cleanup(func() { dnsServers = orig })
+}
+
+// staticHandler answers every query with the given records.
+func staticHandler(records ...string) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.RecursionAvailable = true
+		for _, record := range records {
+			rr, err := dns.NewRR(record)
+			if err == nil {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		_ = w.WriteMsg(m)
+	}
+}
+
+// zoneHandler answers from the given records by name and type. Names without
+// matching records get NXDOMAIN, or NODATA if the name exists, with the zone SOA.
+func zoneHandler(authoritative bool, records ...string) dns.HandlerFunc {
+	var rrs []dns.RR
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			panic(err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = authoritative
+		m.RecursionAvailable = !authoritative
+		q := r.Question[0]
+		exists := false
+		for _, rr := range rrs {
+			if !strings.EqualFold(rr.Header().Name, q.Name) {
+				continue
+			}
+			exists = true
+			if rr.Header().Rrtype == q.Qtype || rr.Header().Rrtype == dns.TypeCNAME {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		if len(m.Answer) == 0 {
+			if !exists {
+				m.Rcode = dns.RcodeNameError
+			}
+			for _, rr := range rrs {
+				if rr.Header().Rrtype == dns.TypeSOA && dns.IsSubDomain(rr.Header().Name, q.Name) {
+					m.Ns = append(m.Ns, rr)
+				}
+			}
+		}
+		_ = w.WriteMsg(m)
+	}
+}
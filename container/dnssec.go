@@ -0,0 +1,515 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	DNSSECSecure        = "secure"
+	DNSSECInsecure      = "insecure"
+	DNSSECBogus         = "bogus"
+	DNSSECIndeterminate = "indeterminate"
+)
+
+// rootTrustAnchorRecords are the DS records of the root zone KSKs, KSK-2017 and KSK-2024.
+var rootTrustAnchorRecords = []string{
+	". 172800 IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". 172800 IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// DNSSECResult is the outcome of validating a single resolver's answer.
+type DNSSECResult struct {
+	AuthenticatedData bool   `json:"ad"`
+	Status            string `json:"status"`
+	FailingLink       string `json:"failing_link,omitempty"`
+	Reason            string `json:"reason,omitempty"`
+	Signatures        int    `json:"rrsigs"`
+}
+
+// chainResult is the state of the chain of trust down to a name.
+type chainResult struct {
+	Zone   string
+	Keys   []*dns.DNSKEY
+	Status string
+	Link   string
+	Reason string
+}
+
+// Validator checks answers against a chain of trust built from the root trust anchors.
+// DNSKEY and DS records are fetched with checking disabled through a single resolver,
+// and every response is cached so repeated validations do not query again.
+// A Validator is not safe for concurrent use.
+type Validator struct {
+	client   *dns.Client
+	resolver DNSServer
+	anchors  []*dns.DS
+	now      time.Time
+	queries  map[string]*dns.Msg
+	chains   map[string]chainResult
+}
+
+// NewValidator returns a validator that fetches keys through the resolver.
+func NewValidator(client *dns.Client, resolver DNSServer) (*Validator, error) {
+	anchors := make([]*dns.DS, 0, len(rootTrustAnchorRecords))
+	for _, record := range rootTrustAnchorRecords {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trust anchor %q: %w", record, err)
+		}
+		ds, ok := rr.(*dns.DS)
+		if !ok {
+			return nil, fmt.Errorf("trust anchor is not a DS record: %s", record)
+		}
+		anchors = append(anchors, ds)
+	}
+	return &Validator{
+		client:   client,
+		resolver: resolver,
+		anchors:  anchors,
+		now:      time.Now(),
+		queries:  map[string]*dns.Msg{},
+		chains:   map[string]chainResult{},
+	}, nil
+}
+
+// indeterminateError is a failure to fetch the records needed for validation, as opposed to records that fail it.
+type indeterminateError struct {
+	err error
+}
+
+func (e *indeterminateError) Error() string {
+	return e.err.Error()
+}
+
+func (e *indeterminateError) Unwrap() error {
+	return e.err
+}
+
+// isIndeterminate reports whether err means the records could not be fetched.
+func isIndeterminate(err error) bool {
+	var indeterminate *indeterminateError
+	return errors.As(err, &indeterminate)
+}
+
+// query fetches name and qtype through the resolver. Transport errors and error rcodes other than
+// NXDOMAIN are returned as indeterminate, responses are cached.
+func (v *Validator) query(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	key := strings.ToLower(dns.Fqdn(name)) + "/" + dns.Type(qtype).String()
+	if resp, ok := v.queries[key]; ok {
+		return resp, nil
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = true
+	m.CheckingDisabled = true
+	m.SetEdns0(4096, true)
+	resp, _, err := ExchangeContext(ctx, v.client, m, v.resolver.AddressString())
+	if err != nil {
+		return nil, &indeterminateError{err}
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, &indeterminateError{fmt.Errorf("%s %s query returned %s", name, dns.Type(qtype).String(), dns.RcodeToString[resp.Rcode])}
+	}
+	v.queries[key] = resp
+	return resp, nil
+}
+
+// rrsets groups the records of a section by owner and type, returning the RRSIGs separately.
+func rrsets(section []dns.RR) (map[string][]dns.RR, map[string][]*dns.RRSIG) {
+	sets := map[string][]dns.RR{}
+	sigs := map[string][]*dns.RRSIG{}
+	for _, rr := range section {
+		name := strings.ToLower(rr.Header().Name)
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			key := name + "/" + dns.Type(sig.TypeCovered).String()
+			sigs[key] = append(sigs[key], sig)
+			continue
+		}
+		if rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		key := name + "/" + dns.Type(rr.Header().Rrtype).String()
+		sets[key] = append(sets[key], rr)
+	}
+	return sets, sigs
+}
+
+// verifyRRset checks that at least one signature over rrset verifies with one of the keys.
+func (v *Validator) verifyRRset(rrset []dns.RR, sigs []*dns.RRSIG, keys []*dns.DNSKEY) error {
+	if len(sigs) == 0 {
+		return fmt.Errorf("missing RRSIG")
+	}
+	var lastErr error
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(v.now) {
+			lastErr = fmt.Errorf("RRSIG by key %d is outside its validity period", sig.KeyTag)
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			if err := sig.Verify(key, rrset); err != nil {
+				lastErr = fmt.Errorf("RRSIG by key %d does not verify: %w", sig.KeyTag, err)
+				continue
+			}
+			return nil
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no DNSKEY with tag %d", sig.KeyTag)
+		}
+	}
+	return lastErr
+}
+
+// zoneKeys fetches the DNSKEY RRset of zone and checks it is signed by a key matching one of the DS records.
+func (v *Validator) zoneKeys(ctx context.Context, zone string, ds []*dns.DS) ([]*dns.DNSKEY, error) {
+	resp, err := v.query(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	sets, sigs := rrsets(resp.Answer)
+	key := strings.ToLower(zone) + "/DNSKEY"
+	var keys []*dns.DNSKEY
+	for _, rr := range sets[key] {
+		if k, ok := rr.(*dns.DNSKEY); ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, &indeterminateError{fmt.Errorf("no DNSKEY records")}
+	}
+	var trusted []*dns.DNSKEY
+	for _, k := range keys {
+		for _, d := range ds {
+			if d.KeyTag != k.KeyTag() || d.Algorithm != k.Algorithm {
+				continue
+			}
+			if digest := k.ToDS(d.DigestType); digest != nil && strings.EqualFold(digest.Digest, d.Digest) {
+				trusted = append(trusted, k)
+			}
+		}
+	}
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("no DNSKEY matches the DS records")
+	}
+	if err := v.verifyRRset(sets[key], sigs[key], trusted); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// provesNoDS checks the signed denial in the authority section shows there is no DS at name.
+// Only exact NSEC and NSEC3 matches, and NSEC3 opt-out spans, are accepted.
+func (v *Validator) provesNoDS(resp *dns.Msg, name string, keys []*dns.DNSKEY) bool {
+	sets, sigs := rrsets(resp.Ns)
+	for key, rrset := range sets {
+		proves := false
+		for _, rr := range rrset {
+			switch denial := rr.(type) {
+			case *dns.NSEC:
+				proves = strings.EqualFold(denial.Hdr.Name, name) && !slices.Contains(denial.TypeBitMap, dns.TypeDS)
+			case *dns.NSEC3:
+				if denial.Match(name) {
+					proves = !slices.Contains(denial.TypeBitMap, dns.TypeDS)
+				} else {
+					proves = denial.Cover(name) && denial.Flags&1 == 1
+				}
+			}
+		}
+		if proves && v.verifyRRset(rrset, sigs[key], keys) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Chain walks from the root trust anchors down to name following DS records. The result holds
+// the keys of the deepest secure zone containing name, or the reason the chain is not secure.
+func (v *Validator) Chain(ctx context.Context, name string) chainResult {
+	name = strings.ToLower(dns.Fqdn(name))
+	if result, ok := v.chains[name]; ok {
+		return result
+	}
+	var result chainResult
+	if name == "." {
+		result = chainResult{Zone: "."}
+		keys, err := v.zoneKeys(ctx, ".", v.anchors)
+		switch {
+		case err == nil:
+			result.Status, result.Keys = DNSSECSecure, keys
+		case isIndeterminate(err):
+			result.Status, result.Link, result.Reason = DNSSECIndeterminate, ". DNSKEY", err.Error()
+		default:
+			result.Status, result.Link, result.Reason = DNSSECBogus, ". DNSKEY", err.Error()
+		}
+		v.chains[name] = result
+		return result
+	}
+
+	labels := dns.SplitDomainName(name)
+	result = v.Chain(ctx, strings.Join(labels[1:], ".")+".")
+	if result.Status != DNSSECSecure {
+		v.chains[name] = result
+		return result
+	}
+	resp, err := v.query(ctx, name, dns.TypeDS)
+	if err != nil {
+		result = chainResult{Status: DNSSECIndeterminate, Link: name + " DS", Reason: err.Error()}
+		v.chains[name] = result
+		return result
+	}
+	sets, sigs := rrsets(resp.Answer)
+	var ds []*dns.DS
+	for _, rr := range sets[name+"/DS"] {
+		if d, ok := rr.(*dns.DS); ok {
+			ds = append(ds, d)
+		}
+	}
+	switch {
+	case len(ds) > 0:
+		if err := v.verifyRRset(sets[name+"/DS"], sigs[name+"/DS"], result.Keys); err != nil {
+			result = chainResult{Status: DNSSECBogus, Link: name + " DS", Reason: err.Error()}
+			break
+		}
+		keys, err := v.zoneKeys(ctx, name, ds)
+		if err != nil {
+			status := DNSSECBogus
+			if isIndeterminate(err) {
+				status = DNSSECIndeterminate
+			}
+			result = chainResult{Status: status, Link: name + " DNSKEY", Reason: err.Error()}
+			break
+		}
+		result = chainResult{Zone: name, Keys: keys, Status: DNSSECSecure}
+	case !v.isZoneApex(ctx, name):
+		// Not a delegation, the name is part of the parent zone.
+	case v.provesNoDS(resp, name, result.Keys):
+		result = chainResult{Zone: name, Status: DNSSECInsecure, Reason: "no DS record for " + name}
+	default:
+		result = chainResult{Status: DNSSECBogus, Link: name + " DS", Reason: "delegation without DS or signed denial"}
+	}
+	v.chains[name] = result
+	return result
+}
+
+// isZoneApex reports whether name has its own SOA record.
+func (v *Validator) isZoneApex(ctx context.Context, name string) bool {
+	resp, err := v.query(ctx, name, dns.TypeSOA)
+	if err != nil {
+		return false
+	}
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == dns.TypeSOA && strings.EqualFold(rr.Header().Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks every RRset in the answer, or the authority section for negative answers,
+// against the chain of trust of its signer.
+func (v *Validator) Validate(ctx context.Context, msg *dns.Msg) DNSSECResult {
+	if msg == nil {
+		return DNSSECResult{Status: DNSSECIndeterminate, Reason: "no response"}
+	}
+	result := DNSSECResult{AuthenticatedData: msg.AuthenticatedData, Status: DNSSECSecure}
+	section := msg.Answer
+	if len(section) == 0 {
+		section = msg.Ns
+	}
+	sets, sigs := rrsets(section)
+	for _, s := range sigs {
+		result.Signatures += len(s)
+	}
+	if len(sets) == 0 && len(msg.Question) > 0 {
+		chain := v.Chain(ctx, msg.Question[0].Name)
+		result.Status, result.FailingLink, result.Reason = chain.Status, chain.Link, chain.Reason
+		if chain.Status == DNSSECSecure {
+			result.Status, result.Reason = DNSSECBogus, "signed zone returned an empty response"
+		}
+		return result
+	}
+
+	keys := make([]string, 0, len(sets))
+	for key := range sets {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	insecure := false
+	for _, key := range keys {
+		rrset := sets[key]
+		link := rrset[0].Header().Name + " " + dns.Type(rrset[0].Header().Rrtype).String()
+		var chain chainResult
+		if len(sigs[key]) > 0 {
+			// The signer must be the zone containing the RRset, not just any secure zone (RFC 4035 section 5.3.1).
+			signer := sigs[key][0].SignerName
+			if !dns.IsSubDomain(signer, rrset[0].Header().Name) {
+				result.Status, result.FailingLink, result.Reason = DNSSECBogus, link, fmt.Sprintf("signer %s is not an ancestor of %s", signer, rrset[0].Header().Name)
+				return result
+			}
+			chain = v.Chain(ctx, signer)
+			if chain.Status == DNSSECSecure && !strings.EqualFold(chain.Zone, dns.Fqdn(signer)) {
+				result.Status, result.FailingLink, result.Reason = DNSSECBogus, link, fmt.Sprintf("signer %s is not a zone apex", signer)
+				return result
+			}
+		} else {
+			chain = v.Chain(ctx, rrset[0].Header().Name)
+		}
+		switch chain.Status {
+		case DNSSECInsecure:
+			insecure = true
+			continue
+		case DNSSECBogus, DNSSECIndeterminate:
+			result.Status, result.FailingLink, result.Reason = chain.Status, chain.Link, chain.Reason
+			return result
+		}
+		if err := v.verifyRRset(rrset, sigs[key], chain.Keys); err != nil {
+			result.Status, result.FailingLink, result.Reason = DNSSECBogus, link, err.Error()
+			return result
+		}
+	}
+	if insecure {
+		result.Status = DNSSECInsecure
+		return result
+	}
+	if len(msg.Answer) == 0 && len(msg.Question) > 0 {
+		if err := ProveDenial(msg); err != nil {
+			q := msg.Question[0]
+			result.Status, result.FailingLink, result.Reason = DNSSECBogus, q.Name+" "+dns.Type(q.Qtype).String(), err.Error()
+		}
+	}
+	return result
+}
+
+// canonicalCompare orders names in the canonical order of RFC 4034 section 6.1, label by label from the root.
+func canonicalCompare(a, b string) int {
+	la, lb := dns.SplitDomainName(strings.ToLower(a)), dns.SplitDomainName(strings.ToLower(b))
+	for i := 1; i <= min(len(la), len(lb)); i++ {
+		if c := strings.Compare(la[len(la)-i], lb[len(lb)-i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(la), len(lb))
+}
+
+// nsecCovers reports whether name falls strictly between the owner and next name of the NSEC record.
+// The last NSEC of a zone points back to the apex and covers everything after its owner.
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	afterOwner := canonicalCompare(nsec.Hdr.Name, name) < 0
+	beforeNext := canonicalCompare(name, nsec.NextDomain) < 0
+	if canonicalCompare(nsec.Hdr.Name, nsec.NextDomain) >= 0 {
+		return afterOwner || beforeNext
+	}
+	return afterOwner && beforeNext
+}
+
+// ancestor returns the last n labels of name.
+func ancestor(name string, n int) string {
+	labels := dns.SplitDomainName(name)
+	return dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+}
+
+// nsec3ClosestEncloser finds the closest encloser proof of RFC 5155 section 7.2.1 for name: an NSEC3 matching
+// an ancestor and one covering the next closer name. optOut tells whether the covering record has opt-out set.
+func nsec3ClosestEncloser(nsec3s []*dns.NSEC3, name string) (encloser string, optOut bool, ok bool) {
+	labels := dns.CountLabel(name)
+	for n := labels - 1; n >= 0; n-- {
+		candidate := ancestor(name, n)
+		if !slices.ContainsFunc(nsec3s, func(rr *dns.NSEC3) bool { return rr.Match(candidate) }) {
+			continue
+		}
+		nextCloser := ancestor(name, n+1)
+		for _, rr := range nsec3s {
+			if rr.Cover(nextCloser) {
+				return candidate, rr.Flags&1 == 1, true
+			}
+		}
+		return "", false, false
+	}
+	return "", false, false
+}
+
+// ProveDenial checks that the NSEC or NSEC3 records in the authority section of a negative answer deny
+// the question: for NXDOMAIN that the name and the wildcard at its closest encloser do not exist, for NODATA
+// that the name exists without the type. The records must already have been validated.
+func ProveDenial(msg *dns.Msg) error {
+	var nsecs []*dns.NSEC
+	var nsec3s []*dns.NSEC3
+	for _, rr := range msg.Ns {
+		switch denial := rr.(type) {
+		case *dns.NSEC:
+			nsecs = append(nsecs, denial)
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, denial)
+		}
+	}
+	q := msg.Question[0]
+	name := strings.ToLower(dns.Fqdn(q.Name))
+	// The type bitmap of an existing name must show neither the type nor a CNAME.
+	denies := func(bitmap []uint16) bool {
+		return !slices.Contains(bitmap, q.Qtype) && !slices.Contains(bitmap, dns.TypeCNAME)
+	}
+	switch {
+	case len(nsecs) > 0 && msg.Rcode == dns.RcodeNameError:
+		for _, nsec := range nsecs {
+			if !nsecCovers(nsec, name) {
+				continue
+			}
+			encloser := ancestor(name, max(dns.CompareDomainName(name, nsec.Hdr.Name), dns.CompareDomainName(name, nsec.NextDomain)))
+			wildcard := "*." + encloser
+			if slices.ContainsFunc(nsecs, func(rr *dns.NSEC) bool { return nsecCovers(rr, wildcard) }) {
+				return nil
+			}
+			return fmt.Errorf("no NSEC denies the wildcard %s", wildcard)
+		}
+		return fmt.Errorf("no NSEC covers %s", name)
+	case len(nsecs) > 0:
+		for _, nsec := range nsecs {
+			if strings.EqualFold(nsec.Hdr.Name, name) {
+				if denies(nsec.TypeBitMap) {
+					return nil
+				}
+				return fmt.Errorf("NSEC at %s lists the %s type", name, dns.Type(q.Qtype).String())
+			}
+			// An empty non-terminal has no NSEC of its own, the NSEC before it points below it.
+			if nsecCovers(nsec, name) && dns.IsSubDomain(name, nsec.NextDomain) {
+				return nil
+			}
+		}
+		return fmt.Errorf("no NSEC matches %s", name)
+	case len(nsec3s) > 0 && msg.Rcode == dns.RcodeNameError:
+		encloser, _, ok := nsec3ClosestEncloser(nsec3s, name)
+		if !ok {
+			return fmt.Errorf("no NSEC3 closest encloser proof for %s", name)
+		}
+		wildcard := "*." + encloser
+		if !slices.ContainsFunc(nsec3s, func(rr *dns.NSEC3) bool { return rr.Cover(wildcard) }) {
+			return fmt.Errorf("no NSEC3 denies the wildcard %s", wildcard)
+		}
+		return nil
+	case len(nsec3s) > 0:
+		for _, rr := range nsec3s {
+			if rr.Match(name) {
+				if denies(rr.TypeBitMap) {
+					return nil
+				}
+				return fmt.Errorf("NSEC3 for %s lists the %s type", name, dns.Type(q.Qtype).String())
+			}
+		}
+		// A DS question may be answered by an opt-out span covering an unsigned delegation.
+		if _, optOut, ok := nsec3ClosestEncloser(nsec3s, name); ok && optOut && q.Qtype == dns.TypeDS {
+			return nil
+		}
+		return fmt.Errorf("no NSEC3 matches %s", name)
+	}
+	return fmt.Errorf("no NSEC or NSEC3 records")
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testZone is a stand-in signed zone with a single combined signing key.
+type testZone struct {
+	name string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newTestZone(t *testing.T, name string) *testZone {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	return &testZone{name: name, key: key, priv: priv.(crypto.Signer)}
+}
+
+// sign returns the rrset followed by its RRSIG made with the zone key.
+func (z *testZone) sign(t *testing.T, rrset ...dns.RR) []dns.RR {
+	t.Helper()
+	now := time.Now()
+	sig := &dns.RRSIG{
+		Algorithm:  z.key.Algorithm,
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.name,
+		Inception:  uint32(now.Add(-time.Hour).Unix()),
+		Expiration: uint32(now.Add(time.Hour).Unix()),
+	}
+	if err := sig.Sign(z.priv, rrset); err != nil {
+		t.Fatalf("unable to sign %v: %v", rrset, err)
+	}
+	return append(rrset, sig)
+}
+
+// signedHierarchy serves a root, a TLD, a signed zone and an unsigned delegation.
+// Answers are keyed by name and type, authority sections for negative answers likewise.
+type signedHierarchy struct {
+	answers   map[string][]dns.RR
+	authority map[string][]dns.RR
+	// zone signs the records of example.test.
+	zone *testZone
+}
+
+func newSignedHierarchy(t *testing.T) *signedHierarchy {
+	t.Helper()
+	root, tld, zone := newTestZone(t, "."), newTestZone(t, "test."), newTestZone(t, "example.test.")
+	h := &signedHierarchy{answers: map[string][]dns.RR{}, authority: map[string][]dns.RR{}, zone: zone}
+	h.answers["./DNSKEY"] = root.sign(t, root.key)
+	h.answers["test./DS"] = root.sign(t, tld.key.ToDS(dns.SHA256))
+	h.answers["test./DNSKEY"] = tld.sign(t, tld.key)
+	h.answers["example.test./DS"] = tld.sign(t, zone.key.ToDS(dns.SHA256))
+	h.answers["example.test./DNSKEY"] = zone.sign(t, zone.key)
+	h.answers["www.example.test./A"] = zone.sign(t, mustRR(t, "www.example.test. 300 IN A 192.0.2.1"))
+	h.answers["insecure.test./SOA"] = []dns.RR{mustRR(t, "insecure.test. 300 IN SOA ns.insecure.test. admin.insecure.test. 1 7200 3600 1209600 300")}
+	h.authority["insecure.test./DS"] = tld.sign(t, mustRR(t, "insecure.test. 300 IN NSEC zzz.test. NS SOA RRSIG NSEC"))
+	h.answers["www.insecure.test./A"] = []dns.RR{mustRR(t, "www.insecure.test. 300 IN A 192.0.2.9")}
+	rootTrustAnchors := rootTrustAnchorRecords
+	rootTrustAnchorRecords = []string{root.key.ToDS(dns.SHA256).String()}
+	t.Cleanup(func() { rootTrustAnchorRecords = rootTrustAnchors })
+	return h
+}
+
+// handler answers from the hierarchy. When tamper is set, A records are rewritten but keep their signature.
+func (h *signedHierarchy) handler(tamper bool) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.RecursionAvailable = true
+		q := r.Question[0]
+		key := strings.ToLower(q.Name) + "/" + dns.TypeToString[q.Qtype]
+		for _, rr := range h.answers[key] {
+			if a, ok := rr.(*dns.A); ok && tamper {
+				rr = &dns.A{Hdr: a.Hdr, A: []byte{198, 51, 100, 66}}
+			}
+			m.Answer = append(m.Answer, rr)
+		}
+		m.Ns = h.authority[key]
+		m.AuthenticatedData = !tamper && len(m.Answer) > 0 && strings.HasSuffix(key, "example.test./A")
+		_ = w.WriteMsg(m)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	h := newSignedHierarchy(t)
+	resolver := startTestDNSServer(t, "Validating", h.handler(false))
+	tampering := startTestDNSServer(t, "Tampering", h.handler(true))
+	client := NewClient()
+	validator, err := NewValidator(client, resolver)
+	if err != nil {
+		t.Fatalf("unable to create validator: %v", err)
+	}
+	query := func(server DNSServer, name string) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		m.SetEdns0(4096, true)
+		resp, _, err := client.Exchange(m, server.AddressString())
+		if err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		return resp
+	}
+
+	result := validator.Validate(context.Background(), query(resolver, "www.example.test."))
+	if result.Status != DNSSECSecure || !result.AuthenticatedData || result.Signatures != 1 {
+		t.Errorf("expected secure answer, got %+v", result)
+	}
+	result = validator.Validate(context.Background(), query(tampering, "www.example.test."))
+	if result.Status != DNSSECBogus || result.FailingLink != "www.example.test. A" {
+		t.Errorf("expected bogus answer, got %+v", result)
+	}
+	result = validator.Validate(context.Background(), query(resolver, "www.insecure.test."))
+	if result.Status != DNSSECInsecure {
+		t.Errorf("expected insecure answer, got %+v", result)
+	}
+	result = validator.Validate(context.Background(), nil)
+	if result.Status != DNSSECIndeterminate {
+		t.Errorf("expected indeterminate without response, got %+v", result)
+	}
+}
+
+func TestValidator_WrongTrustAnchor(t *testing.T) {
+	h := newSignedHierarchy(t)
+	rootTrustAnchorRecords = []string{newTestZone(t, ".").key.ToDS(dns.SHA256).String()}
+	resolver := startTestDNSServer(t, "Validating", h.handler(false))
+	validator, err := NewValidator(NewClient(), resolver)
+	if err != nil {
+		t.Fatalf("unable to create validator: %v", err)
+	}
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.test.", dns.TypeA)
+	resp, _, _ := NewClient().Exchange(m, resolver.AddressString())
+	result := validator.Validate(context.Background(), resp)
+	if result.Status != DNSSECBogus || result.FailingLink != ". DNSKEY" {
+		t.Errorf("expected bogus root, got %+v", result)
+	}
+}
+
+func TestValidator_MisScopedSigner(t *testing.T) {
+	h := newSignedHierarchy(t)
+	resolver := startTestDNSServer(t, "Validating", h.handler(false))
+	validator, err := NewValidator(NewClient(), resolver)
+	if err != nil {
+		t.Fatalf("unable to create validator: %v", err)
+	}
+	// anexample.test. ends in example.test. but is not below it, a valid signature by example.test. must not count.
+	m := new(dns.Msg)
+	m.SetQuestion("www.anexample.test.", dns.TypeA)
+	m.Answer = h.zone.sign(t, mustRR(t, "www.anexample.test. 300 IN A 192.0.2.1"))
+	result := validator.Validate(context.Background(), m)
+	if result.Status != DNSSECBogus || result.FailingLink != "www.anexample.test. A" {
+		t.Errorf("expected bogus answer for a mis-scoped signer, got %+v", result)
+	}
+}
+
+func TestValidator_Denial(t *testing.T) {
+	h := newSignedHierarchy(t)
+	validator, err := NewValidator(NewClient(), startTestDNSServer(t, "Validating", h.handler(false)))
+	if err != nil {
+		t.Fatalf("unable to create validator: %v", err)
+	}
+	soa := h.zone.sign(t, mustRR(t, "example.test. 300 IN SOA ns.example.test. admin.example.test. 1 7200 3600 1209600 300"))
+	hash := func(name string) string { return dns.HashName(name, dns.SHA1, 0, "") }
+	everything := "00000000000000000000000000000000"
+	nsec3 := func(owner, next, types string) []dns.RR {
+		return h.zone.sign(t, mustRR(t, owner+".example.test. 300 IN NSEC3 1 0 0 - "+next+" "+types))
+	}
+	negative := func(name string, qtype uint16, rcode int, denial ...[]dns.RR) *dns.Msg {
+		msg := new(dns.Msg)
+		msg.SetQuestion(name, qtype)
+		msg.Rcode = rcode
+		msg.Ns = append(msg.Ns, soa...)
+		for _, rrs := range denial {
+			msg.Ns = append(msg.Ns, rrs...)
+		}
+		return msg
+	}
+	apexNSEC := h.zone.sign(t, mustRR(t, "example.test. 300 IN NSEC www.example.test. NS SOA RRSIG NSEC DNSKEY"))
+	wwwNSEC := h.zone.sign(t, mustRR(t, "www.example.test. 300 IN NSEC example.test. A RRSIG NSEC"))
+
+	for _, tc := range []struct {
+		name string
+		msg  *dns.Msg
+		want string
+	}{
+		{"NSEC NXDOMAIN", negative("nope.example.test.", dns.TypeA, dns.RcodeNameError, apexNSEC), DNSSECSecure},
+		{"unrelated NSEC NXDOMAIN", negative("nope.example.test.", dns.TypeA, dns.RcodeNameError, wwwNSEC), DNSSECBogus},
+		{"NSEC NODATA", negative("www.example.test.", dns.TypeAAAA, dns.RcodeSuccess, wwwNSEC), DNSSECSecure},
+		{"NSEC NODATA listing the type", negative("www.example.test.", dns.TypeA, dns.RcodeSuccess, wwwNSEC), DNSSECBogus},
+		{"NSEC NODATA for another name", negative("mail.example.test.", dns.TypeA, dns.RcodeSuccess, wwwNSEC), DNSSECBogus},
+		{"NSEC3 NXDOMAIN", negative("nope.example.test.", dns.TypeA, dns.RcodeNameError,
+			nsec3(hash("example.test."), hash("example.test."), "NS SOA RRSIG DNSKEY NSEC3PARAM"),
+			nsec3(everything, "VVVVVVVVVVVVVVVVVVVVVVVVVVVVVVVV", "A")), DNSSECSecure},
+		{"NSEC3 NXDOMAIN without closest encloser", negative("nope.example.test.", dns.TypeA, dns.RcodeNameError,
+			nsec3(everything, "VVVVVVVVVVVVVVVVVVVVVVVVVVVVVVVV", "A")), DNSSECBogus},
+		{"NSEC3 NODATA", negative("www.example.test.", dns.TypeAAAA, dns.RcodeSuccess,
+			nsec3(hash("www.example.test."), hash("www.example.test."), "A RRSIG")), DNSSECSecure},
+		{"no denial", negative("nope.example.test.", dns.TypeA, dns.RcodeNameError), DNSSECBogus},
+	} {
+		if result := validator.Validate(context.Background(), tc.msg); result.Status != tc.want {
+			t.Errorf("%s: expected %s, got %+v", tc.name, tc.want, result)
+		}
+	}
+}
+
+func TestValidator_Indeterminate(t *testing.T) {
+	h := newSignedHierarchy(t)
+	signed := startTestDNSServer(t, "Validating", h.handler(false))
+	m := new(dns.Msg)
+	m.SetQuestion("www.example.test.", dns.TypeA)
+	resp, _, err := NewClient().Exchange(m, signed.AddressString())
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	servfail := startTestDNSServer(t, "Failing", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		_ = w.WriteMsg(m)
+	})
+	noKeys := startTestDNSServer(t, "Empty", staticHandler())
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tc := range []struct {
+		name     string
+		ctx      context.Context
+		resolver DNSServer
+	}{
+		{"servfail", context.Background(), servfail},
+		{"no DNSKEY", context.Background(), noKeys},
+		{"cancelled", cancelled, signed},
+	} {
+		validator, err := NewValidator(NewClient(), tc.resolver)
+		if err != nil {
+			t.Fatalf("unable to create validator: %v", err)
+		}
+		if result := validator.Validate(tc.ctx, resp); result.Status != DNSSECIndeterminate || result.FailingLink != ". DNSKEY" {
+			t.Errorf("%s: expected indeterminate root, got %+v", tc.name, result)
+		}
+	}
+}
+
+func TestNewValidator_BundledTrustAnchors(t *testing.T) {
+	validator, err := NewValidator(NewClient(), DNSServer{})
+	if err != nil || len(validator.anchors) != len(rootTrustAnchorRecords) {
+		t.Errorf("expected bundled trust anchors to parse, got %v", err)
+	}
+}
+
+func TestResolve_DNSSEC(t *testing.T) {
+	h := newSignedHierarchy(t)
+	useDNSServers(t,
+		startTestDNSServer(t, "Validating", h.handler(false)),
+		startTestDNSServer(t, "Tampering", h.handler(true)),
+	)
+	response := Lookup(context.Background(), NewClient(), &ParsedQuestion{Domain: "www.example.test.", Type: dns.TypeA, DNSSEC: true}, dnsServers)
+	status := map[string]string{}
+	for _, answer := range response.Answers {
+		if answer.DNSSEC == nil {
+			t.Fatalf("missing DNSSEC result for %s", answer.DNSServer)
+		}
+		status[answer.DNSServer] = answer.DNSSEC.Status
+	}
+	if status["Validating"] != DNSSECSecure || status["Tampering"] != DNSSECBogus {
+		t.Errorf("unexpected DNSSEC results %v", status)
+	}
+}
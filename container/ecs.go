@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// ECSSubnet is a client subnet used by the ECS sweep, labelled with the country it belongs to.
+type ECSSubnet struct {
+	Country string
+	Subnet  string
+}
+
+// ecsSweepSubnets are consumer ISP prefixes in different countries, used when a sweep names no subnets.
+var ecsSweepSubnets = []ECSSubnet{
+	{Country: "US", Subnet: "73.0.0.0/24"},
+	{Country: "GB", Subnet: "86.128.0.0/24"},
+	{Country: "DE", Subnet: "91.0.0.0/24"},
+	{Country: "FR", Subnet: "90.0.0.0/24"},
+	{Country: "JP", Subnet: "126.0.0.0/24"},
+	{Country: "AU", Subnet: "1.128.0.0/24"},
+	{Country: "BR", Subnet: "177.0.0.0/24"},
+	{Country: "IN", Subnet: "117.192.0.0/24"},
+}
+
+// ECSSweepResult is the answer a resolver gave for one client subnet.
+type ECSSweepResult struct {
+	Country string   `json:"country,omitempty"`
+	Subnet  string   `json:"subnet"`
+	Scope   *int     `json:"scope,omitempty"`
+	Rcode   string   `json:"rcode,omitempty"`
+	Values  []string `json:"values"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// ECSSweepResponse lists the answers for every subnet, and which subnets got the same answer.
+type ECSSweepResponse struct {
+	Question     string              `json:"question"`
+	Type         string              `json:"type"`
+	Server       string              `json:"server"`
+	Results      []ECSSweepResult    `json:"results"`
+	Destinations map[string][]string `json:"destinations"`
+}
+
+// ParseECS parses a client subnet. A bare address is truncated to /24 for IPv4 and /56 for IPv6.
+func ParseECS(raw string) (netip.Prefix, error) {
+	if !strings.Contains(raw, "/") {
+		addr, err := netip.ParseAddr(raw)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid ecs: %s", raw)
+		}
+		bits := 56
+		if addr.Unmap().Is4() {
+			bits = 24
+		}
+		raw = fmt.Sprintf("%s/%d", addr.Unmap(), bits)
+	}
+	prefix, err := netip.ParsePrefix(raw)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid ecs: %s", raw)
+	}
+	return prefix.Masked(), nil
+}
+
+// ECSOption builds the EDNS Client Subnet option (RFC 7871) for prefix.
+func ECSOption(prefix netip.Prefix) *dns.EDNS0_SUBNET {
+	option := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        2,
+		SourceNetmask: uint8(prefix.Bits()),
+		Address:       prefix.Addr().AsSlice(),
+	}
+	if prefix.Addr().Is4() {
+		option.Family = 1
+	}
+	return option
+}
+
+// ECSScope returns the scope prefix length of the client subnet option in msg, if there is one.
+func ECSScope(msg *dns.Msg) *int {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, option := range opt.Option {
+		if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+			scope := int(subnet.SourceScope)
+			return &scope
+		}
+	}
+	return nil
+}
+
+// ECSSweep asks a single server the question once for every subnet.
+func ECSSweep(ctx context.Context, client *dns.Client, parsed *ParsedQuestion, server DNSServer, subnets []ECSSubnet) ECSSweepResponse {
+	sweep := ECSSweepResponse{
+		Question:     parsed.Domain,
+		Type:         dns.Type(parsed.Type).String(),
+		Server:       server.String(),
+		Results:      make([]ECSSweepResult, len(subnets)),
+		Destinations: map[string][]string{},
+	}
+	var wg sync.WaitGroup
+	for i, subnet := range subnets {
+		wg.Add(1)
+		go func(i int, subnet ECSSubnet) {
+			defer wg.Done()
+			result := ECSSweepResult{Country: subnet.Country, Subnet: subnet.Subnet, Values: []string{}}
+			defer func() { sweep.Results[i] = result }()
+			prefix, err := ParseECS(subnet.Subnet)
+			if err != nil {
+				result.Error = err.Error()
+				return
+			}
+			question := *parsed
+			question.ECS = prefix
+			answer, err := QueryServer(ctx, client, NewQuestionMsg(&question), server)
+			if err != nil {
+				result.Error = err.Error()
+				return
+			}
+			result.Scope = ECSScope(answer.msg)
+			result.Rcode = answer.Rcode
+			result.Values = finalValues(answer.msg, parsed.Type)
+		}(i, subnet)
+	}
+	wg.Wait()
+	for _, result := range sweep.Results {
+		if result.Error != "" {
+			continue
+		}
+		key := strings.Join(result.Values, ",")
+		label := result.Subnet
+		if result.Country != "" {
+			label = result.Country + " " + result.Subnet
+		}
+		sweep.Destinations[key] = append(sweep.Destinations[key], label)
+	}
+	return sweep
+}
+
+// ECSSweepEndpoint queries one resolver with a list of client subnets to map geo-steered answers.
+// The resolver is picked with server= by name or address, and subnets= replaces the default list.
+func ECSSweepEndpoint(w http.ResponseWriter, r *http.Request) {
+	parsed, err := ParseURLQuery(r.URL)
+	if err != nil {
+		QueryErrorResponse(w, err)
+		return
+	}
+	if len(parsed.Types) > 1 {
+		QueryErrorResponse(w, fmt.Errorf("ecs sweep supports a single type"))
+		return
+	}
+	parsed.Domain = dns.Fqdn(parsed.Domain)
+	query := r.URL.Query()
+	var server *DNSServer
+	for i, s := range dnsServers {
+		if name := query.Get("server"); name == "" || strings.EqualFold(s.Name, name) || s.Address == name {
+			server = &dnsServers[i]
+			break
+		}
+	}
+	if server == nil {
+		QueryErrorResponse(w, questionErrorf(ErrUnknownServer, "unknown server: %s", query.Get("server")))
+		return
+	}
+	subnets := ecsSweepSubnets
+	if raw := query.Get("subnets"); raw != "" {
+		subnets = nil
+		for _, subnet := range strings.Split(raw, ",") {
+			if _, err := ParseECS(strings.TrimSpace(subnet)); err != nil {
+				QueryErrorResponse(w, err)
+				return
+			}
+			subnets = append(subnets, ECSSubnet{Subnet: strings.TrimSpace(subnet)})
+		}
+	}
+	sweep := ECSSweep(r.Context(), NewClient(), parsed, *server, subnets)
+	if len(sweep.Destinations) == 0 {
+		log.Printf("ECS sweep of %s with %s got no answers", parsed.Domain, server.Name)
+	}
+	JSONResponse(w, sweep)
+}
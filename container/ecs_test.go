@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// ecsHandler answers with an address picked from the client subnet and echoes the option back
+// with a scope of 16, like a geo-steering CDN would.
+func ecsHandler(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	value := "192.0.2.1"
+	if opt := r.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			subnet, ok := option.(*dns.EDNS0_SUBNET)
+			if !ok {
+				continue
+			}
+			if subnet.Family == 1 && subnet.Address.Equal(net.ParseIP("91.0.0.0")) {
+				value = "192.0.2.49"
+			}
+			m.SetEdns0(4096, false)
+			m.IsEdns0().Option = append(m.IsEdns0().Option, &dns.EDNS0_SUBNET{
+				Code:          dns.EDNS0SUBNET,
+				Family:        subnet.Family,
+				SourceNetmask: subnet.SourceNetmask,
+				SourceScope:   16,
+				Address:       subnet.Address,
+			})
+		}
+	}
+	rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A " + value)
+	m.Answer = append(m.Answer, rr)
+	_ = w.WriteMsg(m)
+}
+
+func TestParseECS(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.0/24":  "203.0.113.0/24",
+		"203.0.113.77/24": "203.0.113.0/24",
+		"203.0.113.77":    "203.0.113.0/24",
+		"2001:db8::1":     "2001:db8::/56",
+		"2001:db8::/48":   "2001:db8::/48",
+	}
+	for raw, want := range tests {
+		prefix, err := ParseECS(raw)
+		if err != nil {
+			t.Errorf("ParseECS(%q) error = %v", raw, err)
+			continue
+		}
+		if prefix.String() != want {
+			t.Errorf("ParseECS(%q) = %s, want %s", raw, prefix, want)
+		}
+	}
+	if _, err := ParseECS("not-a-subnet"); err == nil || err.Error() != "invalid ecs: not-a-subnet" {
+		t.Errorf("ParseECS(invalid) error = %v", err)
+	}
+}
+
+func TestNewQuestionMsg_ECS(t *testing.T) {
+	prefix, _ := ParseECS("2001:db8::/48")
+	m := NewQuestionMsg(&ParsedQuestion{Domain: "example.com.", Type: dns.TypeA, ECS: prefix})
+	opt := m.IsEdns0()
+	if opt == nil || opt.Do() {
+		t.Fatalf("OPT = %v, want an OPT record without DO", opt)
+	}
+	subnet, ok := opt.Option[0].(*dns.EDNS0_SUBNET)
+	if !ok || subnet.Family != 2 || subnet.SourceNetmask != 48 || !subnet.Address.Equal(net.ParseIP("2001:db8::")) {
+		t.Errorf("subnet option = %+v", opt.Option[0])
+	}
+}
+
+func TestLookup_ECSScope(t *testing.T) {
+	server := startTestDNSServer(t, "cdn", ecsHandler)
+	parsed, err := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com.&type=A&ecs=91.0.0.0/24"))
+	if err != nil {
+		t.Fatalf("ParseURLQuery() error = %v", err)
+	}
+	response := Lookup(context.Background(), NewClient(), parsed, []DNSServer{server})
+	if response.ECS != "91.0.0.0/24" {
+		t.Errorf("ECS = %q, want 91.0.0.0/24", response.ECS)
+	}
+	if len(response.Answers) != 1 {
+		t.Fatalf("got %d answers, want 1", len(response.Answers))
+	}
+	answer := response.Answers[0]
+	if answer.ECSScope == nil || *answer.ECSScope != 16 || answer.Values[0] != "192.0.2.49" {
+		t.Errorf("answer = %+v, want scope 16 and the steered address", answer)
+	}
+}
+
+func TestParseURLQuery_InvalidECS(t *testing.T) {
+	_, err := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com&type=A&ecs=nope"))
+	if err == nil || err.Error() != "invalid ecs: nope" {
+		t.Errorf("error = %v, want invalid ecs", err)
+	}
+}
+
+func TestECSSweep(t *testing.T) {
+	server := startTestDNSServer(t, "cdn", ecsHandler)
+	parsed := &ParsedQuestion{Domain: "example.com.", Type: dns.TypeA}
+	sweep := ECSSweep(context.Background(), NewClient(), parsed, server, ecsSweepSubnets)
+	if len(sweep.Results) != len(ecsSweepSubnets) {
+		t.Fatalf("got %d results, want %d", len(sweep.Results), len(ecsSweepSubnets))
+	}
+	if got := sweep.Destinations["192.0.2.49"]; len(got) != 1 || got[0] != "DE 91.0.0.0/24" {
+		t.Errorf("destinations for 192.0.2.49 = %v, want only DE", got)
+	}
+	if got := sweep.Destinations["192.0.2.1"]; len(got) != len(ecsSweepSubnets)-1 {
+		t.Errorf("destinations for 192.0.2.1 = %v", got)
+	}
+	for _, result := range sweep.Results {
+		if result.Scope == nil || *result.Scope != 16 {
+			t.Errorf("%s scope = %v, want 16", result.Subnet, result.Scope)
+		}
+	}
+}
+
+func TestECSSweepEndpoint(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "other", staticHandler()), startTestDNSServer(t, "CDN", ecsHandler))
+
+	req := httptest.NewRequest(http.MethodGet, "/ecs_sweep?domain=example.com&type=A&server=cdn&subnets=91.0.0.0/24,2001:db8::/48", nil)
+	rr := httptest.NewRecorder()
+	ECSSweepEndpoint(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var sweep ECSSweepResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &sweep); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(sweep.Results) != 2 || len(sweep.Destinations) != 2 {
+		t.Errorf("sweep = %+v", sweep)
+	}
+
+	for target, code := range map[string]string{
+		"/ecs_sweep?domain=example.com&type=A&server=missing": ErrUnknownServer,
+		"/ecs_sweep?domain=example.com&type=A&subnets=bad":    ErrInvalidParameter,
+		"/ecs_sweep?domain=example.com&type=A,AAAA":           ErrInvalidParameter,
+	} {
+		rr = httptest.NewRecorder()
+		ECSSweepEndpoint(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		var body ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || rr.Code != http.StatusBadRequest || body.Code != code {
+			t.Errorf("%s status = %d, body %s, want 400 %s", target, rr.Code, rr.Body.String(), code)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	TextApplicationType   = "text/plain; charset=utf-8"
+	CSVApplicationType    = "text/csv; charset=utf-8"
+	NDJSONApplicationType = "application/x-ndjson"
+)
+
+// ExportRow is a single record returned by a single server, flattened for CSV and NDJSON.
+// ContainerLocation is where the query was sent from, ServerLocation where the resolver is
+// according to the IP database, empty when none is loaded.
+type ExportRow struct {
+	DNSServer         string `json:"server"`
+	Address           string `json:"server_address"`
+	ContainerLocation string `json:"container_location"`
+	Question          string `json:"question"`
+	Type              string `json:"type"`
+	Rcode             string `json:"rcode"`
+	Value             string `json:"value"`
+	TTL               int    `json:"ttl"`
+	DurationMS        int64  `json:"duration_ms"`
+	ServerLocation    string `json:"server_location"`
+}
+
+var exportHeader = []string{"server", "server_address", "container_location", "question", "type", "rcode", "value", "ttl", "duration_ms", "server_location"}
+
+// acceptFormats maps the media types of the Accept header to output formats.
+var acceptFormats = map[string]string{
+	"text/csv":             "csv",
+	"application/x-ndjson": "ndjson",
+	"application/ndjson":   "ndjson",
+	"application/json":     "json",
+}
+
+// ResponseFormat picks the output format from the format query parameter, falling back to the Accept header.
+// The supported media type with the highest q-value wins, the first one listed on a tie. Types with q=0 are never picked.
+func ResponseFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return strings.ToLower(format)
+	}
+	format, best := "json", 0.0
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		candidate, ok := acceptFormats[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		if q > best {
+			format, best = candidate, q
+		}
+	}
+	return format
+}
+
+// ExportRows flattens a lookup into one row per server per record.
+// Servers without any records still produce a single row with an empty value.
+func ExportRows(response LookupResponse) []ExportRow {
+	rows := make([]ExportRow, 0, len(response.Answers))
+	for _, answer := range response.Answers {
+		base := ExportRow{
+			DNSServer:         answer.DNSServer,
+			Address:           answer.Address,
+			ContainerLocation: response.Location,
+			Question:          response.Question,
+			Type:              response.Type,
+			DurationMS:        answer.Duration.Milliseconds(),
+		}
+		if geo := answer.ServerGeo; geo != nil {
+			base.ServerLocation = strings.Join(slices.DeleteFunc([]string{geo.City, geo.Country}, func(s string) bool { return s == "" }), ", ")
+		}
+		if answer.msg == nil {
+			rows = append(rows, base)
+			continue
+		}
+		base.Rcode = dns.RcodeToString[answer.msg.Rcode]
+		if len(answer.msg.Answer) == 0 {
+			rows = append(rows, base)
+			continue
+		}
+		for _, rr := range answer.msg.Answer {
+			row := base
+			row.Value = RecordValue(rr)
+			row.TTL = int(rr.Header().Ttl)
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func exportFilename(response LookupResponse, extension string) string {
+	return fmt.Sprintf("lookup-%s-%s.%s", strings.TrimSuffix(response.Question, "."), response.Type, extension)
+}
+
+func setAttachment(w http.ResponseWriter, contentType, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+}
+
+// CSVResponse writes rows as a CSV attachment with a header line.
+func CSVResponse(w http.ResponseWriter, filename string, rows []ExportRow) {
+	setAttachment(w, CSVApplicationType, filename)
+	writer := csv.NewWriter(w)
+	_ = writer.Write(exportHeader)
+	for _, row := range rows {
+		_ = writer.Write([]string{
+			row.DNSServer,
+			row.Address,
+			row.ContainerLocation,
+			row.Question,
+			row.Type,
+			row.Rcode,
+			row.Value,
+			strconv.Itoa(row.TTL),
+			strconv.FormatInt(row.DurationMS, 10),
+			row.ServerLocation,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Error writing CSV response: %v", err)
+	}
+}
+
+// NDJSONResponse writes rows as newline delimited JSON.
+func NDJSONResponse(w http.ResponseWriter, filename string, rows []ExportRow) {
+	setAttachment(w, NDJSONApplicationType, filename)
+	encoder := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			log.Printf("Error writing NDJSON response: %v", err)
+			return
+		}
+	}
+}
+
+// TextResponse writes a dig-like block for every server in the lookup.
+func TextResponse(w http.ResponseWriter, response LookupResponse) {
+	w.Header().Set("Content-Type", TextApplicationType)
+	w.WriteHeader(http.StatusOK)
+	writeTextLookup(w, response)
+}
+
+func writeTextLookup(w io.Writer, response LookupResponse) {
+	_, _ = fmt.Fprintf(w, "; <<>> world-dns-resolver %s <<>> %s %s\n", versionString, response.Question, response.Type)
+	_, _ = fmt.Fprintf(w, "; Resolved from %s, %s (%s) in %s\n", response.Location, response.Country, response.Region, response.TotalDurationString)
+	for _, answer := range response.Answers {
+		_, _ = fmt.Fprintln(w)
+		writeDigBlock(w, answer)
+	}
+}
+
+// ZoneResponse writes the answer records in presentation format, grouped by resolver.
+func ZoneResponse(w http.ResponseWriter, response LookupResponse) {
+	w.Header().Set("Content-Type", TextApplicationType)
+	w.WriteHeader(http.StatusOK)
+	writeZoneLookup(w, response)
+}
+
+func writeZoneLookup(w io.Writer, response LookupResponse) {
+	_, _ = fmt.Fprintf(w, "; %s %s\n", response.Question, response.Type)
+	for _, answer := range response.Answers {
+		_, _ = fmt.Fprintf(w, "\n; %s\n", answer.server.String())
+		if answer.msg == nil {
+			continue
+		}
+		for _, rr := range answer.msg.Answer {
+			_, _ = fmt.Fprintln(w, rr.String())
+		}
+	}
+}
+
+func writeDigBlock(w io.Writer, answer DNSServerResponse) {
+	_, _ = fmt.Fprintf(w, "; <<>> @%s <<>> %s\n", answer.Address, answer.DNSServer)
+	msg := answer.msg
+	if msg == nil {
+		_, _ = fmt.Fprintln(w, ";; no response received")
+		return
+	}
+	_, _ = fmt.Fprintf(w, ";; ->>HEADER<<- opcode: %s, status: %s, id: %d\n",
+		dns.OpcodeToString[msg.Opcode], dns.RcodeToString[msg.Rcode], msg.Id)
+	_, _ = fmt.Fprintf(w, ";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		headerFlags(msg), len(msg.Question), len(msg.Answer), len(msg.Ns), len(msg.Extra))
+
+	_, _ = fmt.Fprintln(w, "\n;; QUESTION SECTION:")
+	for _, q := range msg.Question {
+		_, _ = fmt.Fprintln(w, q.String())
+	}
+	if len(msg.Answer) > 0 {
+		_, _ = fmt.Fprintln(w, "\n;; ANSWER SECTION:")
+		for _, rr := range msg.Answer {
+			_, _ = fmt.Fprintln(w, rr.String())
+		}
+	}
+	_, _ = fmt.Fprintf(w, "\n;; Query time: %d msec\n", answer.Duration.Milliseconds())
+	_, _ = fmt.Fprintf(w, ";; SERVER: %s#%d(%s)\n", answer.server.Address, answer.server.Port, answer.DNSServer)
+}
+
+// headerFlags returns the set header bits in the same order dig prints them.
+func headerFlags(msg *dns.Msg) string {
+	flags := make([]string, 0, 7)
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{msg.Response, "qr"},
+		{msg.Authoritative, "aa"},
+		{msg.Truncated, "tc"},
+		{msg.RecursionDesired, "rd"},
+		{msg.RecursionAvailable, "ra"},
+		{msg.AuthenticatedData, "ad"},
+		{msg.CheckingDisabled, "cd"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return strings.Join(flags, " ")
+}
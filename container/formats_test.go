@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResolve_TextFormat(t *testing.T) {
+	server := startTestDNSServer(t, "Local", staticHandler("example.com. 300 IN A 192.0.2.1"))
+	useDNSServers(t, server)
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A&format=text", nil)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+	if ct := resp.Header.Get("Content-Type"); ct != TextApplicationType {
+		t.Errorf("expected Content-Type %q, got %q", TextApplicationType, ct)
+	}
+	for _, line := range []string{
+		"status: NOERROR",
+		";; flags: qr rd ra; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 0",
+		";; ANSWER SECTION:",
+		"example.com.\t300\tIN\tA\t192.0.2.1",
+		";; Query time:",
+		";; SERVER: " + server.Address + "#",
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("text output missing %q, got:\n%s", line, body)
+		}
+	}
+}
+
+func TestResolve_TextFormatKeepsServerOrder(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "Local", staticHandler(
+		"www.example.com. 300 IN CNAME example.com.",
+		"example.com. 300 IN A 192.0.2.1")))
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=www.example.com&type=A&format=text", nil)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	body := w.Body.String()
+	cname, a := strings.Index(body, "\tCNAME\t"), strings.Index(body, "\tA\t192.0.2.1")
+	if cname < 0 || a < 0 || cname > a {
+		t.Errorf("expected the CNAME before the A record, got:\n%s", body)
+	}
+}
+
+func TestResolve_ZoneFormat(t *testing.T) {
+	server := startTestDNSServer(t, "Local", staticHandler("example.com. 300 IN A 192.0.2.1", "example.com. 300 IN A 192.0.2.2"))
+	useDNSServers(t, server)
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A&format=zone", nil)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	body, _ := io.ReadAll(w.Result().Body)
+	content := string(body)
+	if !strings.Contains(content, "; "+server.String()) {
+		t.Errorf("zone output missing resolver header, got:\n%s", content)
+	}
+	if strings.Count(content, "\tIN\tA\t") != 2 {
+		t.Errorf("expected 2 A records, got:\n%s", content)
+	}
+}
+
+func TestResolve_CSVFormat(t *testing.T) {
+	server := startTestDNSServer(t, "Local", staticHandler("example.com. 300 IN A 192.0.2.1", "example.com. 60 IN A 192.0.2.2"))
+	useDNSServers(t, server)
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	resp := w.Result()
+	if ct := resp.Header.Get("Content-Type"); ct != CSVApplicationType {
+		t.Errorf("expected Content-Type %q, got %q", CSVApplicationType, ct)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename=lookup-example.com-A.csv` {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("unable to parse CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected header and 2 rows, got %d", len(records))
+	}
+	if records[2][0] != "Local" || records[2][5] != "NOERROR" || records[2][6] != "192.0.2.2" || records[2][7] != "60" {
+		t.Errorf("unexpected row %v", records[2])
+	}
+}
+
+func TestResolve_NDJSONFormat(t *testing.T) {
+	server := startTestDNSServer(t, "Local", staticHandler())
+	useDNSServers(t, server)
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A&format=ndjson", nil)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	resp := w.Result()
+	if ct := resp.Header.Get("Content-Type"); ct != NDJSONApplicationType {
+		t.Errorf("expected Content-Type %q, got %q", NDJSONApplicationType, ct)
+	}
+	var row ExportRow
+	if err := json.NewDecoder(resp.Body).Decode(&row); err != nil {
+		t.Fatalf("unable to decode row: %v", err)
+	}
+	if row.Question != "example.com." || row.Value != "" || row.Rcode != "NOERROR" {
+		t.Errorf("unexpected row %+v", row)
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	tests := []struct {
+		url    string
+		accept string
+		want   string
+	}{
+		{"/lookup", "", "json"},
+		{"/lookup?format=TEXT", "", "text"},
+		{"/lookup?format=zone", "text/csv", "zone"},
+		{"/lookup", "text/csv", "csv"},
+		{"/lookup", "application/x-ndjson;q=0.9, */*", "ndjson"},
+		{"/lookup", "application/json;q=0.5, text/csv;q=0.8", "csv"},
+		{"/lookup", "text/csv, application/x-ndjson", "csv"},
+		{"/lookup", "text/csv;q=0, application/json;q=0.1", "json"},
+		{"/lookup", "text/csv;q=0", "json"},
+		{"/lookup", "text/csv;q=abc, application/x-ndjson;q=0.2", "ndjson"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.url, nil)
+		req.Header.Set("Accept", tt.accept)
+		if got := ResponseFormat(req); got != tt.want {
+			t.Errorf("ResponseFormat(%q, %q) = %q, want %q", tt.url, tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestExportRows_Locations(t *testing.T) {
+	response := LookupResponse{
+		Question: "example.com.",
+		Type:     "A",
+		Location: "SFO",
+		Answers: []DNSServerResponse{
+			{DNSServer: "Located", ServerGeo: &GeoInfo{City: "Amsterdam", Country: "NL"}},
+			{DNSServer: "Unknown"},
+		},
+	}
+	rows := ExportRows(response)
+	if len(rows) != 2 || rows[0].ContainerLocation != "SFO" || rows[0].ServerLocation != "Amsterdam, NL" || rows[1].ServerLocation != "" {
+		t.Errorf("rows = %+v", rows)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// geoDB is loaded from MMDB_PATH at startup and stays nil when no database is configured.
+var geoDB *GeoDB
+
+// GeoInfo is what the IP databases know about an address.
+type GeoInfo struct {
+	IP           string `json:"ip"`
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Country      string `json:"country,omitempty"`
+	City         string `json:"city,omitempty"`
+	Continent    string `json:"continent,omitempty"`
+}
+
+// GeoGroup lists where the answers went for resolvers in one region.
+type GeoGroup struct {
+	ResolverRegion string   `json:"resolver_region"`
+	Servers        []string `json:"servers"`
+	Destinations   []string `json:"destinations"`
+	Summary        string   `json:"summary"`
+}
+
+// GeoDB combines one or more MMDB files, e.g. an ASN database and a country or city database.
+type GeoDB struct {
+	dbs []*MMDB
+}
+
+// LoadGeoDB opens every comma separated path.
+func LoadGeoDB(paths string) (*GeoDB, error) {
+	geo := &GeoDB{}
+	for _, path := range strings.Split(paths, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		db, err := OpenMMDB(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %s: %w", path, err)
+		}
+		geo.dbs = append(geo.dbs, db)
+	}
+	if len(geo.dbs) == 0 {
+		return nil, fmt.Errorf("no MMDB files in %q", paths)
+	}
+	return geo, nil
+}
+
+// Lookup merges what every database knows about ip. The first database with a value wins.
+func (g *GeoDB) Lookup(ip string) (GeoInfo, bool) {
+	info := GeoInfo{IP: ip}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return info, false
+	}
+	found := false
+	for _, db := range g.dbs {
+		record, err := db.Lookup(addr)
+		if err != nil {
+			log.Printf("Error looking up %s in %s: %v", ip, db.DatabaseType, err)
+			continue
+		}
+		if record == nil {
+			continue
+		}
+		found = true
+		if info.ASN == 0 {
+			info.ASN = geoASN(record)
+		}
+		info.Organization = cmp.Or(info.Organization, geoString(record, "autonomous_system_organization"), geoString(record, "as_name"))
+		info.Country = cmp.Or(info.Country, geoString(record, "country", "iso_code"), geoString(record, "country_code"))
+		info.City = cmp.Or(info.City, geoString(record, "city", "names", "en"))
+		info.Continent = cmp.Or(info.Continent, geoString(record, "continent", "code"), geoString(record, "continent_code"))
+	}
+	return info, found
+}
+
+// geoString follows path through nested maps and returns the string at the end.
+func geoString(record map[string]any, path ...string) string {
+	var value any = record
+	for _, key := range path {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		value = m[key]
+	}
+	s, _ := value.(string)
+	return s
+}
+
+// geoASN understands both the MaxMind number and the IPinfo "AS13335" form.
+func geoASN(record map[string]any) uint {
+	if n := mmdbUint(record["autonomous_system_number"]); n != 0 {
+		return n
+	}
+	if s := geoString(record, "asn"); s != "" {
+		n, _ := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "AS"), 10, 32)
+		return uint(n)
+	}
+	return 0
+}
+
+// Label describes where an address lives, e.g. "Akamai (JP, Tokyo)".
+func (i GeoInfo) Label() string {
+	place := strings.Join(slices.DeleteFunc([]string{i.Country, i.City}, func(s string) bool { return s == "" }), ", ")
+	name := i.Organization
+	if name == "" && i.ASN != 0 {
+		name = fmt.Sprintf("AS%d", i.ASN)
+	}
+	switch {
+	case name == "" && place == "":
+		return i.IP
+	case place == "":
+		return name
+	case name == "":
+		return place
+	}
+	return name + " (" + place + ")"
+}
+
+// AnnotateGeo adds the location of every A and AAAA value and of the resolver itself,
+// then summarises which destinations resolvers in each region were sent to.
+func AnnotateGeo(geo *GeoDB, response *LookupResponse) {
+	groups := map[string]*GeoGroup{}
+	for i := range response.Answers {
+		answer := &response.Answers[i]
+		if info, ok := geo.Lookup(answer.Address); ok {
+			answer.ServerGeo = &info
+		}
+		region := "unknown"
+		if answer.ServerGeo != nil {
+			region = cmp.Or(answer.ServerGeo.Continent, answer.ServerGeo.Country, region)
+		}
+		group, ok := groups[region]
+		if !ok {
+			group = &GeoGroup{ResolverRegion: region}
+			groups[region] = group
+		}
+		group.Servers = append(group.Servers, answer.DNSServer)
+		if answer.msg == nil {
+			continue
+		}
+		for _, rr := range answer.msg.Answer {
+			var ip string
+			switch v := rr.(type) {
+			case *dns.A:
+				ip = v.A.String()
+			case *dns.AAAA:
+				ip = v.AAAA.String()
+			default:
+				continue
+			}
+			info, _ := geo.Lookup(ip)
+			answer.Geo = append(answer.Geo, info)
+			if label := info.Label(); !slices.Contains(group.Destinations, label) {
+				group.Destinations = append(group.Destinations, label)
+			}
+		}
+	}
+	response.GeoSummary = make([]GeoGroup, 0, len(groups))
+	for _, group := range groups {
+		slices.Sort(group.Servers)
+		slices.Sort(group.Destinations)
+		destinations := "no addresses"
+		if len(group.Destinations) > 0 {
+			destinations = strings.Join(group.Destinations, ", ")
+		}
+		group.Summary = fmt.Sprintf("resolvers in %s got %s", group.ResolverRegion, destinations)
+		response.GeoSummary = append(response.GeoSummary, *group)
+	}
+	slices.SortFunc(response.GeoSummary, func(a, b GeoGroup) int {
+		return cmp.Compare(a.ResolverRegion, b.ResolverRegion)
+	})
+}
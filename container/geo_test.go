@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testGeoDB(t *testing.T) *GeoDB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	err := os.WriteFile(path, buildMMDB(t, map[string]map[string]any{
+		"127.0.0.0/8": {"country_code": "DE", "continent_code": "EU"},
+		"192.0.2.0/24": {
+			"autonomous_system_number":       uint32(64500),
+			"autonomous_system_organization": "Example CDN",
+			"country":                        map[string]any{"iso_code": "DE"},
+			"city":                           map[string]any{"names": map[string]any{"en": "Frankfurt"}},
+		},
+	}), 0o600)
+	if err != nil {
+		t.Fatalf("unable to write database: %v", err)
+	}
+	geo, err := LoadGeoDB(path + ", ")
+	if err != nil {
+		t.Fatalf("unable to load database: %v", err)
+	}
+	return geo
+}
+
+func TestGeoDB_Lookup(t *testing.T) {
+	geo := testGeoDB(t)
+	info, ok := geo.Lookup("192.0.2.1")
+	if !ok || info.ASN != 64500 || info.Country != "DE" || info.City != "Frankfurt" {
+		t.Errorf("unexpected info %+v", info)
+	}
+	if label := info.Label(); label != "Example CDN (DE, Frankfurt)" {
+		t.Errorf("unexpected label %q", label)
+	}
+	if _, ok := geo.Lookup("198.51.100.1"); ok {
+		t.Errorf("expected no info for unknown address")
+	}
+	if _, err := LoadGeoDB(" , "); err == nil {
+		t.Errorf("expected error without any paths")
+	}
+}
+
+func TestResolve_GeoAnnotations(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "Local", staticHandler("example.com. 300 IN A 192.0.2.1")))
+	origGeo := geoDB
+	geoDB = testGeoDB(t)
+	t.Cleanup(func() { geoDB = origGeo })
+
+	parsed, _ := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com.&type=A"))
+	response := Lookup(context.Background(), NewClient(), parsed, dnsServers)
+	answer := response.Answers[0]
+	if len(answer.Geo) != 1 || answer.Geo[0].Organization != "Example CDN" {
+		t.Errorf("unexpected annotations %+v", answer.Geo)
+	}
+	if answer.ServerGeo == nil || answer.ServerGeo.Continent != "EU" {
+		t.Errorf("unexpected server location %+v", answer.ServerGeo)
+	}
+	if len(response.GeoSummary) != 1 || !strings.Contains(response.GeoSummary[0].Summary, "resolvers in EU got Example CDN (DE, Frankfurt)") {
+		t.Errorf("unexpected summary %+v", response.GeoSummary)
+	}
+}
+
+func TestResolve_WithoutGeoDB(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "Local", staticHandler("example.com. 300 IN A 192.0.2.1")))
+	origGeo := geoDB
+	geoDB = nil
+	t.Cleanup(func() { geoDB = origGeo })
+
+	parsed, _ := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com.&type=A"))
+	response := Lookup(context.Background(), NewClient(), parsed, dnsServers)
+	if response.GeoSummary != nil || response.Answers[0].Geo != nil {
+		t.Errorf("expected no annotations without a database")
+	}
+}
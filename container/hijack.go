@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// bogonPrefixes are networks that should never be returned for a public name.
+var bogonPrefixes = []struct {
+	Prefix netip.Prefix
+	Name   string
+}{
+	{netip.MustParsePrefix("0.0.0.0/8"), "unspecified"},
+	{netip.MustParsePrefix("10.0.0.0/8"), "RFC 1918 private"},
+	{netip.MustParsePrefix("100.64.0.0/10"), "carrier-grade NAT"},
+	{netip.MustParsePrefix("127.0.0.0/8"), "loopback"},
+	{netip.MustParsePrefix("169.254.0.0/16"), "link-local"},
+	{netip.MustParsePrefix("172.16.0.0/12"), "RFC 1918 private"},
+	{netip.MustParsePrefix("192.168.0.0/16"), "RFC 1918 private"},
+	{netip.MustParsePrefix("198.18.0.0/15"), "benchmarking"},
+	{netip.MustParsePrefix("240.0.0.0/4"), "reserved"},
+	{netip.MustParsePrefix("::/128"), "unspecified"},
+	{netip.MustParsePrefix("::1/128"), "loopback"},
+	{netip.MustParsePrefix("fc00::/7"), "unique local"},
+	{netip.MustParsePrefix("fe80::/10"), "link-local"},
+}
+
+// knownSinkholes are block page and sinkhole networks used by filtering resolvers and takedown operators.
+var knownSinkholes = []struct {
+	Prefix netip.Prefix
+	Name   string
+}{
+	{netip.MustParsePrefix("146.112.61.104/31"), "OpenDNS block page"},
+	{netip.MustParsePrefix("146.112.61.106/31"), "OpenDNS block page"},
+	{netip.MustParsePrefix("146.112.61.108/32"), "OpenDNS block page"},
+	{netip.MustParsePrefix("146.112.61.110/32"), "OpenDNS block page"},
+	{netip.MustParsePrefix("208.91.112.55/32"), "FortiGuard block page"},
+	{netip.MustParsePrefix("213.180.193.250/32"), "Yandex.DNS block page"},
+	{netip.MustParsePrefix("93.158.134.250/32"), "Yandex.DNS block page"},
+	{netip.MustParsePrefix("156.154.175.215/32"), "Norton ConnectSafe block page"},
+	{netip.MustParsePrefix("156.154.176.215/32"), "Norton ConnectSafe block page"},
+	{netip.MustParsePrefix("131.253.18.11/32"), "Microsoft sinkhole"},
+	{netip.MustParsePrefix("131.253.18.12/32"), "Microsoft sinkhole"},
+	{netip.MustParsePrefix("199.2.137.0/24"), "Microsoft sinkhole"},
+}
+
+// Manipulation verdicts of DetectManipulation.
+const (
+	ManipulationNone      = "none"
+	ManipulationSuspected = "suspected"
+	// ManipulationUnknown is returned when the probe name was answered but the authoritative
+	// servers could not be asked whether it exists.
+	ManipulationUnknown = "unknown"
+)
+
+// hijackProbes holds the answers for a random non-existent name from every resolver
+// and from the authoritative servers.
+type hijackProbes struct {
+	Name          string
+	Answers       map[DNSServer]*dns.Msg
+	Authoritative *dns.Msg
+}
+
+// SinkholeReason returns why the address looks like a sinkhole or bogon, or "" if it looks fine.
+func SinkholeReason(value string) string {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	for _, sinkhole := range knownSinkholes {
+		if sinkhole.Prefix.Contains(addr) {
+			return sinkhole.Name
+		}
+	}
+	for _, bogon := range bogonPrefixes {
+		if bogon.Prefix.Contains(addr) {
+			return bogon.Name + " address"
+		}
+	}
+	return ""
+}
+
+// ProbeName returns a random label under domain that should not exist.
+func ProbeName(domain string) string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "wdr-probe-" + hex.EncodeToString(b) + "." + dns.Fqdn(domain)
+}
+
+// RunHijackProbes asks every resolver over fanOutClient, the client of the fan-out, and the authoritative
+// servers, found through resolver over client, for a random non-existent name.
+func RunHijackProbes(ctx context.Context, client *dns.Client, resolver DNSServer, fanOutClient *dns.Client, servers []DNSServer, domain string) hijackProbes {
+	probes := hijackProbes{Name: ProbeName(domain), Answers: make(map[DNSServer]*dns.Msg, len(servers))}
+	m := new(dns.Msg)
+	m.SetQuestion(probes.Name, dns.TypeA)
+	m.RecursionDesired = true
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		probes.Authoritative, _, _ = LookupAuthoritative(ctx, client, resolver, probes.Name, dns.TypeA)
+	}()
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server DNSServer) {
+			defer wg.Done()
+			resp, _, err := ExchangeContext(ctx, serverClient(fanOutClient, server), m.Copy(), server.AddressString())
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			probes.Answers[server] = resp
+			mu.Unlock()
+		}(server)
+	}
+	wg.Wait()
+	return probes
+}
+
+// DetectManipulation checks an answer for sinkhole addresses the authoritative servers did not return,
+// for data where the authoritative servers return NXDOMAIN, and for a rewritten NXDOMAIN on the probe name.
+// The authoritative answers may be nil when they could not be fetched, an answered probe name then gives
+// ManipulationUnknown as a rewrite cannot be told apart from a name that exists.
+func DetectManipulation(answer DNSServerResponse, auth *dns.Msg, probes hijackProbes) (string, string) {
+	if answer.msg == nil {
+		return ManipulationNone, ""
+	}
+	authValues := map[string]bool{}
+	if auth != nil {
+		for _, rr := range auth.Answer {
+			authValues[CanonicalValue(rr)] = true
+		}
+	}
+	for _, rr := range answer.msg.Answer {
+		value := CanonicalValue(rr)
+		if reason := SinkholeReason(value); reason != "" && !authValues[value] {
+			return ManipulationSuspected, fmt.Sprintf("answer %s is a %s", value, reason)
+		}
+	}
+	if auth != nil && auth.Rcode == dns.RcodeNameError && answer.msg.Rcode == dns.RcodeSuccess && len(answer.msg.Answer) > 0 {
+		return ManipulationSuspected, fmt.Sprintf("authoritative servers return NXDOMAIN but the resolver answered %s", strings.Join(answer.Values, ", "))
+	}
+	probe, ok := probes.Answers[answer.server]
+	if !ok || probe.Rcode != dns.RcodeSuccess || len(probe.Answer) == 0 {
+		return ManipulationNone, ""
+	}
+	values := make([]string, len(probe.Answer))
+	for i, rr := range probe.Answer {
+		values[i] = RecordValue(rr)
+	}
+	switch {
+	case probes.Authoritative == nil:
+		return ManipulationUnknown, fmt.Sprintf("%s was answered with %s but the authoritative servers could not be asked", probes.Name, strings.Join(values, ", "))
+	case probes.Authoritative.Rcode == dns.RcodeNameError:
+		return ManipulationSuspected, fmt.Sprintf("NXDOMAIN for %s was rewritten to %s", probes.Name, strings.Join(values, ", "))
+	}
+	return ManipulationNone, ""
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSinkholeReason(t *testing.T) {
+	tests := map[string]string{
+		"0.0.0.0":               "unspecified address",
+		"127.0.0.1":             "loopback address",
+		"192.168.1.1":           "RFC 1918 private address",
+		"146.112.61.104":        "OpenDNS block page",
+		"::ffff:146.112.61.105": "OpenDNS block page",
+		"208.91.112.55":         "FortiGuard block page",
+		"199.2.137.42":          "Microsoft sinkhole",
+		"::1":                   "loopback address",
+		"::ffff:10.0.0.1":       "RFC 1918 private address",
+		"93.184.216.34":         "",
+		"example.com.":          "",
+	}
+	for value, want := range tests {
+		if got := SinkholeReason(value); got != want {
+			t.Errorf("SinkholeReason(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestProbeName(t *testing.T) {
+	a, b := ProbeName("example.com"), ProbeName("example.com")
+	if a == b || !strings.HasSuffix(a, ".example.com.") || !dns.IsFqdn(a) {
+		t.Errorf("unexpected probe names %q, %q", a, b)
+	}
+}
+
+func TestResolve_HijackCheck(t *testing.T) {
+	zone := []string{
+		"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 900",
+		"example.com. 3600 IN NS ns1.example.com.",
+		"ns1.example.com. 3600 IN A 127.0.0.1",
+		"example.com. 300 IN A 192.0.2.1",
+	}
+	honest := zoneHandler(false, zone...)
+	rewriting := func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   []byte{192, 0, 2, 1},
+		})
+		if !strings.EqualFold(r.Question[0].Name, "example.com.") {
+			m.Answer[0].(*dns.A).A = []byte{198, 51, 100, 99}
+		}
+		_ = w.WriteMsg(m)
+	}
+	sinkhole := staticHandler("example.com. 300 IN A 0.0.0.0")
+	auth := startTestDNSServer(t, "ns1.example.com.", zoneHandler(true, zone...))
+	useDNSServers(t,
+		startTestDNSServer(t, "Honest", honest),
+		startTestDNSServer(t, "Rewriting", rewriting),
+		startTestDNSServer(t, "Sinkhole", sinkhole),
+	)
+	origPort := authoritativePort
+	authoritativePort = auth.Port
+	t.Cleanup(func() { authoritativePort = origPort })
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A&hijack_check=true", nil)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	var response LookupResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&response); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	verdicts := map[string]DNSServerResponse{}
+	for _, answer := range response.Answers {
+		verdicts[answer.DNSServer] = answer
+	}
+	if v := verdicts["Honest"]; v.SuspectedManipulation == nil || *v.SuspectedManipulation || v.ManipulationVerdict != ManipulationNone {
+		t.Errorf("expected honest resolver to be clean, got %+v", v)
+	}
+	if v := verdicts["Rewriting"]; v.SuspectedManipulation == nil || !*v.SuspectedManipulation || !strings.Contains(v.ManipulationReason, "198.51.100.99") {
+		t.Errorf("expected NXDOMAIN rewrite, got %+v", v)
+	}
+	if v := verdicts["Sinkhole"]; v.SuspectedManipulation == nil || !*v.SuspectedManipulation || !strings.Contains(v.ManipulationReason, "unspecified") {
+		t.Errorf("expected sinkhole, got %+v", v)
+	}
+}
+
+func TestResolve_HijackCheckTLS(t *testing.T) {
+	zone := []string{
+		"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 900",
+		"example.com. 3600 IN NS ns1.example.com.",
+		"ns1.example.com. 3600 IN A 127.0.0.1",
+		"example.com. 300 IN A 192.0.2.1",
+	}
+	var plainProbed atomic.Bool
+	honest := zoneHandler(false, zone...)
+	plain := startTestDNSServer(t, "Plain", func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.Question[0].Qtype == dns.TypeA && strings.HasPrefix(r.Question[0].Name, "wdr-probe-") {
+			plainProbed.Store(true)
+		}
+		honest(w, r)
+	})
+	rewriting := startTestTLSServer(t, "Rewriting", "dns.test", func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		a := []byte{192, 0, 2, 1}
+		if !strings.EqualFold(r.Question[0].Name, "example.com.") {
+			a = []byte{198, 51, 100, 99}
+		}
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   a,
+		})
+		_ = w.WriteMsg(m)
+	})
+	auth := startTestDNSServer(t, "ns1.example.com.", zoneHandler(true, zone...))
+	origPort := authoritativePort
+	authoritativePort = auth.Port
+	t.Cleanup(func() { authoritativePort = origPort })
+
+	parsed, err := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com.&type=A&hijack_check=true&transport=tls"))
+	if err != nil {
+		t.Fatalf("ParseURLQuery() error = %v", err)
+	}
+	response := Lookup(context.Background(), NewClient(), parsed, []DNSServer{plain, rewriting})
+	if len(response.Answers) != 1 {
+		t.Fatalf("response = %+v, want a single TLS answer", response)
+	}
+	if v := response.Answers[0]; v.SuspectedManipulation == nil || !*v.SuspectedManipulation || !strings.Contains(v.ManipulationReason, "198.51.100.99") {
+		t.Errorf("expected NXDOMAIN rewrite over TLS, got %+v", v)
+	}
+	if plainProbed.Load() {
+		t.Error("a server without TLS was probed")
+	}
+}
+
+func TestDetectManipulation_UnknownProbe(t *testing.T) {
+	server := DNSServer{Name: "Rewriting"}
+	answer := DNSServerResponse{server: server, msg: msgWith(t, dns.RcodeSuccess, "example.com. 300 IN A 192.0.2.1")}
+	rewritten := msgWith(t, dns.RcodeSuccess, "wdr-probe-1.example.com. 60 IN A 198.51.100.99")
+	nxdomain := msgWith(t, dns.RcodeNameError)
+
+	tests := []struct {
+		name          string
+		probe         *dns.Msg
+		authoritative *dns.Msg
+		want          string
+	}{
+		{"rewritten", rewritten, nxdomain, ManipulationSuspected},
+		{"authoritative unavailable", rewritten, nil, ManipulationUnknown},
+		{"nxdomain without authoritative", nxdomain, nil, ManipulationNone},
+	}
+	for _, tt := range tests {
+		probes := hijackProbes{Name: "wdr-probe-1.example.com.", Answers: map[DNSServer]*dns.Msg{server: tt.probe}, Authoritative: tt.authoritative}
+		if verdict, reason := DetectManipulation(answer, nil, probes); verdict != tt.want {
+			t.Errorf("%s: DetectManipulation() = %q, %q, want %q", tt.name, verdict, reason, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile converts names with UTS #46 non-transitional processing. StrictDomainName is off so
+// underscore labels such as _dmarc keep working.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// idnScripts are the scripts reported for homograph checks, in the order they are listed.
+var idnScripts = []struct {
+	Name  string
+	Table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Armenian", unicode.Armenian},
+	{"Georgian", unicode.Georgian},
+	{"Arabic", unicode.Arabic},
+	{"Hebrew", unicode.Hebrew},
+	{"Devanagari", unicode.Devanagari},
+	{"Thai", unicode.Thai},
+	{"Han", unicode.Han},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Hangul", unicode.Hangul},
+}
+
+// idnScriptSets are mixes of scripts that are normal in a single label.
+var idnScriptSets = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Hangul"},
+}
+
+// latinLookalikes are Cyrillic and Greek letters that render like Latin letters.
+const latinLookalikes = "аЬсԁеһіјӏоԛрѕսхуԝАВЕНІЈКМОРЅТХҮαβεικνορτυχΑΒΕΖΗΙΚΜΝΟΡΤΥΧ"
+
+// IDNInfo describes an internationalized question name.
+type IDNInfo struct {
+	ALabel        string   `json:"a_label"`
+	ULabel        string   `json:"u_label"`
+	Scripts       []string `json:"scripts"`
+	HomographRisk string   `json:"homograph_risk,omitempty"`
+}
+
+// isIDN reports whether domain has non-ASCII characters or A-labels.
+func isIDN(domain string) bool {
+	for _, r := range domain {
+		if r > unicode.MaxASCII {
+			return true
+		}
+	}
+	for _, label := range strings.Split(strings.ToLower(domain), ".") {
+		if strings.HasPrefix(label, "xn--") {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeDomain converts an internationalized domain to its A-label form. Plain ASCII names
+// are returned unchanged with a nil IDNInfo.
+func NormalizeDomain(domain string) (string, *IDNInfo, error) {
+	if !isIDN(domain) {
+		return domain, nil, nil
+	}
+	ascii, err := idnaProfile.ToASCII(domain)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid internationalized domain %s: %v", domain, err)
+	}
+	unicodeName, err := idnaProfile.ToUnicode(ascii)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid internationalized domain %s: %v", domain, err)
+	}
+	info := &IDNInfo{ALabel: ascii, ULabel: unicodeName, Scripts: []string{}}
+	for _, label := range strings.Split(unicodeName, ".") {
+		scripts := labelScripts(label)
+		for _, script := range scripts {
+			if !slices.Contains(info.Scripts, script) {
+				info.Scripts = append(info.Scripts, script)
+			}
+		}
+		if info.HomographRisk == "" {
+			info.HomographRisk = homographRisk(label, scripts)
+		}
+	}
+	return ascii, info, nil
+}
+
+// labelScripts returns the scripts used by the letters of label.
+func labelScripts(label string) []string {
+	var scripts []string
+	for _, r := range label {
+		for _, script := range idnScripts {
+			if unicode.Is(script.Table, r) && !slices.Contains(scripts, script.Name) {
+				scripts = append(scripts, script.Name)
+			}
+		}
+	}
+	return scripts
+}
+
+// homographRisk explains why label could be mistaken for another name, or returns "".
+func homographRisk(label string, scripts []string) string {
+	if len(scripts) > 1 {
+		for _, allowed := range idnScriptSets {
+			if !slices.ContainsFunc(scripts, func(s string) bool { return !slices.Contains(allowed, s) }) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("label %q mixes %s scripts", label, strings.Join(scripts, " and "))
+	}
+	if len(scripts) == 1 && (scripts[0] == "Cyrillic" || scripts[0] == "Greek") {
+		for _, r := range label {
+			if unicode.IsLetter(r) && !strings.ContainsRune(latinLookalikes, r) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("label %q only uses %s letters that look like Latin letters", label, scripts[0])
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		domain  string
+		ascii   string
+		unicode string
+		risk    bool
+	}{
+		{"bücher.de", "xn--bcher-kva.de", "bücher.de", false},
+		{"BÜCHER.de.", "xn--bcher-kva.de.", "bücher.de.", false},
+		{"xn--bcher-kva.de", "xn--bcher-kva.de", "bücher.de", false},
+		{"_dmarc.bücher.de", "_dmarc.xn--bcher-kva.de", "_dmarc.bücher.de", false},
+		{"аpple.com", "xn--pple-43d.com", "аpple.com", true},
+		{"xn--80ak6aa92e.com", "xn--80ak6aa92e.com", "аррӏе.com", true},
+		{"日本語テスト.jp", "xn--zckzah9945czlbtz6h.jp", "日本語テスト.jp", false},
+	}
+	for _, tt := range tests {
+		ascii, info, err := NormalizeDomain(tt.domain)
+		if err != nil {
+			t.Errorf("NormalizeDomain(%q) error = %v", tt.domain, err)
+			continue
+		}
+		if ascii != tt.ascii || info == nil || info.ALabel != tt.ascii || info.ULabel != tt.unicode {
+			t.Errorf("NormalizeDomain(%q) = %q, %+v, want %q and %q", tt.domain, ascii, info, tt.ascii, tt.unicode)
+			continue
+		}
+		if (info.HomographRisk != "") != tt.risk {
+			t.Errorf("NormalizeDomain(%q) homograph risk = %q, want risk %v", tt.domain, info.HomographRisk, tt.risk)
+		}
+	}
+}
+
+func TestNormalizeDomain_ASCII(t *testing.T) {
+	ascii, info, err := NormalizeDomain("Example.COM")
+	if err != nil || ascii != "Example.COM" || info != nil {
+		t.Errorf("NormalizeDomain(ASCII) = %q, %+v, %v, want the name unchanged", ascii, info, err)
+	}
+}
+
+func TestNormalizeDomain_Invalid(t *testing.T) {
+	for _, domain := range []string{"xn--zz.com", "bücher-.de"} {
+		if _, _, err := NormalizeDomain(domain); err == nil || !strings.HasPrefix(err.Error(), "invalid internationalized domain "+domain) {
+			t.Errorf("NormalizeDomain(%q) error = %v", domain, err)
+		}
+	}
+}
+
+func TestHomographRisk_MixedScripts(t *testing.T) {
+	scripts := labelScripts("pаypal")
+	if !slices.Equal(scripts, []string{"Latin", "Cyrillic"}) {
+		t.Fatalf("labelScripts() = %v", scripts)
+	}
+	if risk := homographRisk("pаypal", scripts); !strings.Contains(risk, "mixes Latin and Cyrillic") {
+		t.Errorf("homographRisk() = %q", risk)
+	}
+	if risk := homographRisk("пример", labelScripts("пример")); risk != "" {
+		t.Errorf("homographRisk(plain Cyrillic) = %q, want none", risk)
+	}
+}
+
+func TestResolveEndpoint_IDN(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "static", staticHandler("xn--bcher-kva.de. 300 IN A 192.0.2.1")))
+
+	req := httptest.NewRequest(http.MethodGet, "/lookup?domain=b%C3%BCcher.de&type=A", nil)
+	rr := httptest.NewRecorder()
+	ResolveEndpoint(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var response LookupResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if response.Question != "xn--bcher-kva.de." || response.IDN == nil || response.IDN.ULabel != "bücher.de" {
+		t.Errorf("question = %q, idn = %+v", response.Question, response.IDN)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxSamples caps samples= so a single request cannot flood the upstream resolvers.
+const maxSamples = 20
+
+// LatencyStats summarises repeated queries against one server. Times are in milliseconds.
+type LatencyStats struct {
+	Samples  int     `json:"samples"`
+	Received int     `json:"received"`
+	LossRate float64 `json:"loss_rate"`
+	MinMS    float64 `json:"min_ms"`
+	MeanMS   float64 `json:"mean_ms"`
+	P50MS    float64 `json:"p50_ms"`
+	P95MS    float64 `json:"p95_ms"`
+	MaxMS    float64 `json:"max_ms"`
+	JitterMS float64 `json:"jitter_ms"`
+	// FirstQueryUncached is set when the first query was much slower than the rest,
+	// which suggests the answer was not cached until the first query.
+	FirstQueryUncached bool `json:"first_query_uncached"`
+}
+
+type latencySample struct {
+	round  int
+	answer DNSServerResponse
+}
+
+// Sample runs the question against every server in rounds, waiting interval between rounds.
+// Each server gets one query per round so a server never has more than one query in flight.
+// The answer of the first successful round is returned with the latency statistics attached,
+// servers that lost every query get an entry without answer and a loss rate of 1.
+// Queries cut off by ctx count as lost and their servers are returned as incomplete.
+func Sample(ctx context.Context, client *dns.Client, m *dns.Msg, servers []DNSServer, samples int, interval time.Duration) ([]DNSServerResponse, []string) {
+	results := make(map[DNSServer][]latencySample, len(servers))
+	cutOff := map[DNSServer]bool{}
+	// sent is the number of rounds that were started, no new round is started once ctx is done.
+	sent := 0
+	for round := 0; round < samples; round++ {
+		if round > 0 && interval > 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+			}
+		}
+		if round > 0 && ctx.Err() != nil {
+			break
+		}
+		sent++
+		for answer := range FanOut(ctx, client, m, servers) {
+			if answer.Incomplete {
+				cutOff[answer.server] = true
+				continue
+			}
+			results[answer.server] = append(results[answer.server], latencySample{round: round, answer: answer})
+		}
+	}
+	answers := make([]DNSServerResponse, 0, len(servers))
+	var incomplete []string
+	for _, server := range servers {
+		if cutOff[server] {
+			incomplete = append(incomplete, server.Name)
+		}
+		received := results[server]
+		if len(received) == 0 {
+			answers = append(answers, DNSServerResponse{
+				DNSServer: server.Name,
+				Address:   server.Address,
+				Values:    []string{},
+				Latency:   NewLatencyStats(nil, sent, false),
+				server:    server,
+			})
+			continue
+		}
+		durations := make([]time.Duration, len(received))
+		for i, sample := range received {
+			durations[i] = sample.answer.Duration
+		}
+		answer := received[0].answer
+		answer.Latency = NewLatencyStats(durations, sent, received[0].round == 0)
+		answers = append(answers, answer)
+	}
+	return answers, incomplete
+}
+
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*1000) / 1000
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// NewLatencyStats computes the statistics of the received durations, in the order they were sent,
+// out of the number of queries sent. firstIsFirstRound tells whether durations[0] is the very first query.
+func NewLatencyStats(durations []time.Duration, sent int, firstIsFirstRound bool) *LatencyStats {
+	stats := &LatencyStats{Samples: sent, Received: len(durations)}
+	if sent > 0 {
+		stats.LossRate = math.Round(float64(sent-len(durations))/float64(sent)*1000) / 1000
+	}
+	if len(durations) == 0 {
+		return stats
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	var total, jitter time.Duration
+	for i, d := range durations {
+		total += d
+		if i > 0 {
+			diff := d - durations[i-1]
+			jitter += max(diff, -diff)
+		}
+	}
+	stats.MinMS = milliseconds(sorted[0])
+	stats.MaxMS = milliseconds(sorted[len(sorted)-1])
+	stats.MeanMS = milliseconds(total / time.Duration(len(durations)))
+	stats.P50MS = milliseconds(percentile(sorted, 50))
+	stats.P95MS = milliseconds(percentile(sorted, 95))
+	if len(durations) > 1 {
+		stats.JitterMS = milliseconds(jitter / time.Duration(len(durations)-1))
+	}
+	if firstIsFirstRound && len(durations) >= 3 {
+		rest := slices.Clone(durations[1:])
+		slices.Sort(rest)
+		median := percentile(rest, 50)
+		stats.FirstQueryUncached = durations[0] > 2*median && durations[0]-median >= 5*time.Millisecond
+	}
+	return stats
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestNewLatencyStats(t *testing.T) {
+	ms := time.Millisecond
+	stats := NewLatencyStats([]time.Duration{50 * ms, 10 * ms, 12 * ms, 10 * ms}, 5, true)
+	if stats.Received != 4 || stats.LossRate != 0.2 {
+		t.Errorf("unexpected counts %+v", stats)
+	}
+	if stats.MinMS != 10 || stats.MaxMS != 50 || stats.MeanMS != 20.5 || stats.P50MS != 10 || stats.P95MS != 50 {
+		t.Errorf("unexpected latency %+v", stats)
+	}
+	if stats.JitterMS != 14.667 {
+		t.Errorf("expected jitter 14.667ms, got %v", stats.JitterMS)
+	}
+	if !stats.FirstQueryUncached {
+		t.Errorf("expected slow first query to be inferred as uncached")
+	}
+	if NewLatencyStats([]time.Duration{50 * ms, 10 * ms, 12 * ms}, 3, false).FirstQueryUncached {
+		t.Errorf("expected no inference when the first round was lost")
+	}
+	if stats := NewLatencyStats(nil, 3, true); stats.LossRate != 1 || stats.Received != 0 {
+		t.Errorf("unexpected stats without samples %+v", stats)
+	}
+}
+
+func TestResolve_Samples(t *testing.T) {
+	var queries atomic.Int32
+	counting := func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		staticHandler("example.com. 300 IN A 192.0.2.1")(w, r)
+	}
+	useDNSServers(t, startTestDNSServer(t, "Local", counting))
+	parsed, err := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com.&type=A&samples=4&sample_interval_ms=1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response := Lookup(context.Background(), NewClient(), parsed, dnsServers)
+	if queries.Load() != 4 {
+		t.Errorf("expected 4 queries, got %d", queries.Load())
+	}
+	if len(response.Answers) != 1 || response.Answers[0].Latency == nil || response.Answers[0].Latency.Received != 4 {
+		t.Errorf("unexpected answers %+v", response.Answers)
+	}
+}
+
+func TestLookup_SamplesLost(t *testing.T) {
+	answering := startTestDNSServer(t, "Answering", staticHandler("example.com. 300 IN A 192.0.2.1"))
+	silent := startTestDNSServer(t, "Silent", func(w dns.ResponseWriter, r *dns.Msg) {})
+	parsed := &ParsedQuestion{Domain: "example.com.", Type: dns.TypeA, Samples: 2, Deadline: 300 * time.Millisecond}
+
+	response := Lookup(context.Background(), NewClient(), parsed, []DNSServer{answering, silent})
+	var lost *DNSServerResponse
+	for i := range response.Answers {
+		if response.Answers[i].DNSServer == "Silent" {
+			lost = &response.Answers[i]
+		}
+	}
+	if lost == nil || lost.Latency == nil || lost.Latency.LossRate != 1 || lost.Latency.Received != 0 {
+		t.Fatalf("expected an entry with a loss rate of 1 for the silent server, got %+v", response.Answers)
+	}
+	if len(response.Incomplete) != 1 || response.Incomplete[0] != "Silent" {
+		t.Errorf("Incomplete = %v, want [Silent]", response.Incomplete)
+	}
+	if response.Consensus == nil || response.Consensus.AgreementPercent != 100 || len(response.Consensus.Outliers) != 0 {
+		t.Errorf("Consensus = %+v, want the lost server left out", response.Consensus)
+	}
+}
+
+func TestParseURLQuery_InvalidSamples(t *testing.T) {
+	for _, query := range []string{"samples=0", "samples=100", "samples=abc", "sample_interval_ms=-1"} {
+		if _, err := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com&type=A&"+query)); err == nil {
+			t.Errorf("expected error for %s", query)
+		}
+	}
+}
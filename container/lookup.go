@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fanOutLimit bounds the number of concurrent upstream queries of a single fan-out.
+var fanOutLimit = 32
+
+// NewClient returns the client used to query upstream resolvers.
+func NewClient() *dns.Client {
+	client := new(dns.Client)
+	client.Timeout = 5 * time.Second
+	return client
+}
+
+// NewQuestionMsg builds the recursive query sent to every resolver.
+func NewQuestionMsg(parsed *ParsedQuestion) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(parsed.Domain, parsed.Type)
+	m.RecursionDesired = parsed.RD
+	m.CheckingDisabled = parsed.CD
+	m.AuthenticatedData = parsed.AD
+	if parsed.DNSSEC || parsed.DO || parsed.ECS.IsValid() || parsed.Cookies {
+		m.SetEdns0(4096, parsed.DNSSEC || parsed.DO)
+	}
+	if parsed.Cookies {
+		// The cookie itself is filled in per server by QueryServer.
+		opt := m.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE})
+	}
+	if parsed.ECS.IsValid() {
+		opt := m.IsEdns0()
+		opt.Option = append(opt.Option, ECSOption(parsed.ECS))
+	}
+	return m
+}
+
+// NewLookupResponse returns an empty response for the question, tagged with the container location.
+func NewLookupResponse(parsed *ParsedQuestion) LookupResponse {
+	response := LookupResponse{
+		Question: parsed.Domain,
+		Type:     dns.Type(parsed.Type).String(),
+		Country:  os.Getenv("CLOUDFLARE_COUNTRY_A2"),
+		Location: os.Getenv("CLOUDFLARE_LOCATION"),
+		Region:   os.Getenv("CLOUDFLARE_REGION"),
+		Answers:  make([]DNSServerResponse, 0, len(dnsServers)),
+		Flags: QueryFlags{
+			RD: parsed.RD,
+			DO: parsed.DNSSEC || parsed.DO,
+			CD: parsed.CD,
+			AD: parsed.AD,
+		},
+	}
+	if parsed.IDN != nil {
+		response.IDN = parsed.IDN
+	}
+	if parsed.ECS.IsValid() {
+		response.ECS = parsed.ECS.String()
+	}
+	if parsed.TLS {
+		response.Transport = "tls"
+	}
+	return response
+}
+
+// Lookup fans the question out to the servers and collects, analyses and sorts their answers.
+// With a deadline the upstream queries still running when it expires are cancelled and their
+// servers listed as incomplete. When ctx is cancelled the answers received so far are returned as is.
+func Lookup(ctx context.Context, client *dns.Client, parsed *ParsedQuestion, servers []DNSServer) LookupResponse {
+	response := NewLookupResponse(parsed)
+	lookupStart := time.Now()
+	upstream := ctx
+	if parsed.Deadline > 0 {
+		var cancel context.CancelFunc
+		upstream, cancel = context.WithTimeout(ctx, parsed.Deadline)
+		defer cancel()
+	}
+	var authoritative chan *dns.Msg
+	if (parsed.TTLCheck || parsed.HijackCheck) && len(servers) > 0 {
+		authoritative = make(chan *dns.Msg, 1)
+		go func() {
+			resp, _, err := LookupAuthoritative(upstream, client, servers[0], parsed.Domain, parsed.Type)
+			if err != nil {
+				log.Printf("Error querying authoritative servers for %s: %v", parsed.Domain, err)
+			}
+			authoritative <- resp
+		}()
+	}
+	// The fan-out and the follow-up queries to the same servers use the requested transport, the other checks query over UDP.
+	fanOutClient, fanOutServers := UpstreamTransport(client, parsed, servers)
+	var hijack chan hijackProbes
+	if parsed.HijackCheck && len(servers) > 0 {
+		hijack = make(chan hijackProbes, 1)
+		go func() {
+			hijack <- RunHijackProbes(upstream, client, servers[0], fanOutClient, fanOutServers, parsed.Domain)
+		}()
+	}
+	if parsed.Samples > 1 {
+		answers, incomplete := Sample(upstream, fanOutClient, NewQuestionMsg(parsed), fanOutServers, parsed.Samples, parsed.SampleInterval)
+		response.Answers = append(response.Answers, answers...)
+		response.Incomplete = append(response.Incomplete, incomplete...)
+	} else {
+		for answer := range FanOut(upstream, fanOutClient, NewQuestionMsg(parsed), fanOutServers) {
+			if answer.Incomplete {
+				response.Incomplete = append(response.Incomplete, answer.DNSServer)
+				continue
+			}
+			response.Answers = append(response.Answers, answer)
+		}
+	}
+	if ctx.Err() != nil {
+		log.Printf("Lookup of %s cancelled: %v", parsed.Domain, context.Cause(ctx))
+		response.TotalDuration = time.Since(lookupStart)
+		response.TotalDurationString = response.TotalDuration.String()
+		return response
+	}
+	AddChains(upstream, fanOutClient, response.Answers, parsed)
+	if parsed.FCrDNS && parsed.IP.IsValid() {
+		CheckFCrDNS(upstream, fanOutClient, response.Answers, parsed.IP)
+	}
+	var auth *dns.Msg
+	if authoritative != nil {
+		select {
+		case auth = <-authoritative:
+		case <-upstream.Done():
+		}
+	}
+	if parsed.TTLCheck && auth != nil {
+		ttl := FinalTTL(auth, parsed.Type)
+		response.AuthoritativeTTL = &ttl
+		for i, answer := range response.Answers {
+			if answer.msg == nil {
+				continue
+			}
+			response.Answers[i].TTLAnomaly, response.Answers[i].TTLAnomalyReason = DetectTTLAnomaly(answer.msg, auth)
+		}
+	}
+	if hijack != nil {
+		select {
+		case probes := <-hijack:
+			for i, answer := range response.Answers {
+				verdict, reason := DetectManipulation(answer, auth, probes)
+				if verdict != ManipulationUnknown {
+					suspected := verdict == ManipulationSuspected
+					response.Answers[i].SuspectedManipulation = &suspected
+				}
+				response.Answers[i].ManipulationVerdict = verdict
+				response.Answers[i].ManipulationReason = reason
+			}
+		case <-upstream.Done():
+		}
+	}
+	if parsed.DNSSEC && len(servers) > 0 {
+		validator, err := NewValidator(client, servers[0])
+		if err != nil {
+			log.Printf("Error creating DNSSEC validator: %v", err)
+		} else {
+			for i, answer := range response.Answers {
+				result := validator.Validate(upstream, answer.msg)
+				response.Answers[i].DNSSEC = &result
+			}
+		}
+	}
+	if geoDB != nil {
+		AnnotateGeo(geoDB, &response)
+	}
+	if len(parsed.Expected) > 0 {
+		response.Propagation = CheckPropagation(response.Answers, parsed.Expected, parsed.Type)
+	}
+	response.TotalDuration = time.Since(lookupStart)
+	response.TotalDurationString = response.TotalDuration.String()
+	_ = SortAnswers(response.Answers, parsed.Sort)
+	response.Consensus = BuildConsensus(response.Answers)
+	return response
+}
+
+// ExchangeContext is client.ExchangeContext that also gives up when ctx is cancelled,
+// the library only applies the deadline of ctx to the connection. Queries over TLS are padded.
+func ExchangeContext(ctx context.Context, client *dns.Client, m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	if isEncrypted(client) {
+		m = PadMsg(m, queryPaddingBlock)
+	}
+	conn, err := client.DialContext(ctx, address)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+	return client.ExchangeWithConnContext(ctx, m, conn)
+}
+
+// QueryServer sends m to a single server and converts the reply into a DNSServerResponse.
+// When m has a cookie option it is sent with the cookies cached for the server.
+// m is shared by every server of a fan-out, so only a copy is sent as packing writes to its OPT record.
+func QueryServer(ctx context.Context, client *dns.Client, m *dns.Msg, server DNSServer) (DNSServerResponse, error) {
+	m = m.Copy()
+	client = serverClient(client, server)
+	answer := DNSServerResponse{
+		DNSServer: server.Name,
+		Address:   server.Address,
+		server:    server,
+	}
+	var resp *dns.Msg
+	var duration time.Duration
+	var err error
+	if hasCookie(m) {
+		resp, duration, answer.Cookie, err = ExchangeCookie(ctx, client, cookieJar, m, server)
+	} else {
+		resp, duration, err = ExchangeContext(ctx, client, m, server.AddressString())
+	}
+	if err != nil {
+		return answer, err
+	}
+	answer.msg = resp
+	answer.Padded = isEncrypted(client) && ResponsePadded(resp)
+	answer.rawSignature = RawSignature(resp)
+	answer.AnswerHash = CanonicalizeAnswer(resp)
+	answer.Duration = duration
+	answer.DurationString = duration.String()
+	answer.Rcode = dns.RcodeToString[resp.Rcode]
+	answer.TTL = FinalTTL(resp, m.Question[0].Qtype)
+	// The JSON output uses canonical order, msg keeps the order of the server for the text formats.
+	records := CanonicalOrder(resp.Answer)
+	answer.Records = RecordTTLs(records)
+	answer.ECSScope = ECSScope(resp)
+	if len(records) == 0 {
+		log.Printf("No answer found for %v with %s", m.Question[0].Name, server.Name)
+	}
+	// Values only holds records of the question type, aliases leading to them are in Records and the CNAME chain.
+	answer.Values = []string{}
+	for _, ans := range records {
+		if ans.Header().Rrtype == m.Question[0].Qtype {
+			answer.Values = append(answer.Values, RecordValue(ans))
+		}
+	}
+	return answer, nil
+}
+
+// FanOut queries every server concurrently and delivers each answer as soon as it arrives.
+// Servers that fail to answer are logged and skipped. The channel is closed once all servers are done.
+// At most fanOutLimit queries are in flight at once. Once ctx is done the outstanding queries are
+// cancelled and their servers delivered with Incomplete set.
+func FanOut(ctx context.Context, client *dns.Client, m *dns.Msg, servers []DNSServer) <-chan DNSServerResponse {
+	answers := make(chan DNSServerResponse, len(servers))
+	slots := make(chan struct{}, fanOutLimit)
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server DNSServer) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				answers <- DNSServerResponse{DNSServer: server.Name, Address: server.Address, Incomplete: true, server: server}
+				return
+			}
+			defer func() { <-slots }()
+			answer, err := QueryServer(ctx, client, m, server)
+			if err != nil && contextExpired(ctx) {
+				answer.Incomplete = true
+				answers <- answer
+				return
+			}
+			if err != nil {
+				q := m.Question[0]
+				log.Printf("Error resolving %s / %s with %s: %v", q.Name, dns.Type(q.Qtype).String(), server.Name, err)
+				return
+			}
+			answers <- answer
+		}(server)
+	}
+	go func() {
+		wg.Wait()
+		close(answers)
+	}()
+	return answers
+}
+
+// contextExpired reports whether ctx is done or past its deadline. The connection deadline taken
+// from ctx can expire just before ctx itself is marked done.
+func contextExpired(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func slowHandler(delay time.Duration) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		time.Sleep(delay)
+		staticHandler("example.com. 300 IN A 192.0.2.2")(w, r)
+	}
+}
+
+func TestResolve_Deadline(t *testing.T) {
+	fast := startTestDNSServer(t, "fast", staticHandler("example.com. 300 IN A 192.0.2.1"))
+	slow := startTestDNSServer(t, "slow", slowHandler(time.Second))
+	useDNSServers(t, fast, slow)
+
+	start := time.Now()
+	req := httptest.NewRequest(http.MethodGet, "/lookup?domain=example.com&type=A&deadline_ms=200", nil)
+	rr := httptest.NewRecorder()
+	ResolveEndpoint(rr, req)
+	if elapsed := time.Since(start); elapsed > 800*time.Millisecond {
+		t.Errorf("lookup took %s, want it to stop at the deadline", elapsed)
+	}
+	var response LookupResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(response.Answers) != 1 || response.Answers[0].DNSServer != "fast" {
+		t.Errorf("Answers = %+v, want only the fast server", response.Answers)
+	}
+	if !slices.Equal(response.Incomplete, []string{"slow"}) {
+		t.Errorf("Incomplete = %v, want [slow]", response.Incomplete)
+	}
+}
+
+func TestResolve_InvalidDeadline(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/lookup?domain=example.com&type=A&deadline_ms=5", nil)
+	rr := httptest.NewRecorder()
+	ResolveEndpoint(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLookup_Cancelled(t *testing.T) {
+	slow := startTestDNSServer(t, "slow", slowHandler(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	parsed := &ParsedQuestion{Domain: "example.com.", Type: dns.TypeA, TTLCheck: true}
+	response := Lookup(ctx, NewClient(), parsed, []DNSServer{slow})
+	if elapsed := time.Since(start); elapsed > 800*time.Millisecond {
+		t.Errorf("lookup took %s, want the upstream query to be cancelled", elapsed)
+	}
+	if len(response.Answers) != 0 || !slices.Equal(response.Incomplete, []string{"slow"}) {
+		t.Errorf("response = %+v, want the slow server to be incomplete", response)
+	}
+}
+
+func TestLookup_DeadlineStopsLaterStages(t *testing.T) {
+	// The resolver answers the question itself at once but is slow for the SOA, NS, probe and DNSKEY
+	// queries made by the checks that run after the fan-out.
+	server := startTestDNSServer(t, "resolver", func(w dns.ResponseWriter, r *dns.Msg) {
+		if q := r.Question[0]; q.Name != "example.com." || q.Qtype != dns.TypeA {
+			time.Sleep(time.Second)
+		}
+		staticHandler("example.com. 300 IN A 192.0.2.1")(w, r)
+	})
+	parsed := &ParsedQuestion{Domain: "example.com.", Type: dns.TypeA, RD: true, TTLCheck: true, HijackCheck: true, DNSSEC: true, Deadline: 200 * time.Millisecond}
+
+	start := time.Now()
+	response := Lookup(context.Background(), NewClient(), parsed, []DNSServer{server})
+	if elapsed := time.Since(start); elapsed > 800*time.Millisecond {
+		t.Errorf("lookup took %s, want the checks to stop at the deadline", elapsed)
+	}
+	if len(response.Answers) != 1 {
+		t.Fatalf("Answers = %+v", response.Answers)
+	}
+	if result := response.Answers[0].DNSSEC; result == nil || result.Status != DNSSECIndeterminate {
+		t.Errorf("DNSSEC = %+v, want indeterminate once the deadline expired", result)
+	}
+}
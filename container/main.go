@@ -11,7 +11,6 @@ import (
 	"runtime/debug"
 	"sort"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
@@ -71,6 +70,15 @@ func main() {
 	c := make(chan os.Signal, 10)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
+	if path := os.Getenv("MMDB_PATH"); path != "" {
+		db, err := LoadGeoDB(path)
+		if err != nil {
+			log.Printf("Unable to load IP database, answers will not be annotated: %v", err)
+		} else {
+			geoDB = db
+		}
+	}
+
 	mux := http.NewServeMux()
 
 	// Create a sub-mux for /v1
@@ -85,6 +93,13 @@ func main() {
 	})
 	v1mux.HandleFunc("/debug", DebugHandler)
 	v1mux.HandleFunc("/lookup", ResolveEndpoint)
+	v1mux.HandleFunc("/propagation", PropagationEndpoint)
+	v1mux.HandleFunc("/trace", TraceEndpoint)
+	v1mux.HandleFunc("/delegation", DelegationEndpoint)
+	v1mux.HandleFunc("/zone_report", ZoneReportEndpoint)
+	v1mux.HandleFunc("/ecs_sweep", ECSSweepEndpoint)
+	v1mux.HandleFunc("/batch", BatchEndpoint)
+	v1mux.HandleFunc("/reverse", ReverseEndpoint)
 	v1mux.HandleFunc("/dns_types", DNSTypesEndpoint)
 	v1mux.HandleFunc("/dns_servers", DNSServerEndpoint)
 
@@ -122,89 +137,60 @@ func ResolveEndpoint(w http.ResponseWriter, r *http.Request) {
 	// For now, it returns a placeholder string.
 	parsed, err := ParseURLQuery(r.URL)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid query parameters: %v", err), http.StatusBadRequest)
+		QueryErrorResponse(w, err)
 		return
 	}
-	if !strings.HasSuffix(parsed.Domain, ".") {
-		parsed.Domain += "."
-	}
-	// Ensure the domain is a valid FQDN
-	if !dns.IsFqdn(parsed.Domain) {
-		http.Error(w, "Invalid domain name", http.StatusBadRequest)
+	parsed.Domain = dns.Fqdn(parsed.Domain)
+	client := NewClient()
+	if len(parsed.Types) > 1 {
+		if StreamFormat(r) != "" {
+			QueryErrorResponse(w, fmt.Errorf("stream does not support more than one type"))
+			return
+		}
+		WriteMultiLookupResponse(w, r, MultiLookup(r.Context(), client, parsed, dnsServers))
 		return
 	}
-	m1 := new(dns.Msg)
-	m1.SetQuestion(parsed.Domain, parsed.Type)
-	m1.RecursionDesired = true
-	client := new(dns.Client)
-	client.Timeout = 5 * time.Second
-	response := LookupResponse{
-		Question: parsed.Domain,
-		Type:     dns.TypeToString[parsed.Type],
-		Country:  os.Getenv("CLOUDFLARE_COUNTRY_A2"),
-		Location: os.Getenv("CLOUDFLARE_LOCATION"),
-		Region:   os.Getenv("CLOUDFLARE_REGION"),
-		Answers:  make([]DNSServerResponse, 0, len(dnsServers)),
+	if stream := StreamFormat(r); stream != "" {
+		if unsupported := StreamUnsupported(parsed); len(unsupported) > 0 {
+			QueryErrorResponse(w, fmt.Errorf("stream does not support %s", strings.Join(unsupported, ", ")))
+			return
+		}
+		ctx := r.Context()
+		if parsed.Deadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, parsed.Deadline)
+			defer cancel()
+		}
+		streamClient, servers := UpstreamTransport(client, parsed, dnsServers)
+		StreamResponse(w, stream, NewLookupResponse(parsed), len(servers), FanOut(ctx, streamClient, NewQuestionMsg(parsed), servers))
+		return
 	}
-	var (
-		mu sync.Mutex
-		wg sync.WaitGroup
-	)
-	lookupStart := time.Now()
-	for _, server := range dnsServers {
-		wg.Add(1)
-		go func(server DNSServer) {
-			defer wg.Done()
-			answer := DNSServerResponse{
-				DNSServer: server.Name,
-				Address:   server.Address,
-			}
-			resp, duration, err := client.Exchange(m1, server.AddressString())
-			if err != nil {
-				// Optionally log error, but don't write to w from goroutine
-				log.Printf("Error resolving %s / %s with %s: %v", parsed.Domain, dns.TypeToString[parsed.Type], server.Name, err)
-				return
-			}
-			if len(resp.Answer) == 0 {
-				// Optionally log error, but don't write to w from goroutine
-				log.Printf("No answer found for %v with %s", m1.Question[0].Name, server.Name)
-				answer.Values = []string{}
-				mu.Lock()
-				response.Answers = append(response.Answers, answer)
-				mu.Unlock()
-				return
-			}
-			answer.Duration = duration
-			answer.DurationString = duration.String()
-			answer.TTL = int(resp.Answer[0].Header().Ttl)
-			answer.Values = make([]string, len(resp.Answer))
-			for i, ans := range resp.Answer {
-				if a, ok := ans.(*dns.CNAME); ok {
-					answer.Values[i] = a.Target
-				} else {
-					stringAnswer := ans.String()
-					parts := strings.Split(stringAnswer, "\t")
-					if len(parts) > 0 {
-						answer.Values[i] = parts[len(parts)-1]
-					} else {
-						answer.Values[i] = stringAnswer // Use the full string as a fallback
-					}
-				}
-			}
-			mu.Lock()
-			response.Answers = append(response.Answers, answer)
-			mu.Unlock()
-		}(server)
+	WriteLookupResponse(w, r, Lookup(r.Context(), client, parsed, dnsServers))
+}
+
+// WriteLookupResponse writes the lookup in the format requested by the client.
+func WriteLookupResponse(w http.ResponseWriter, r *http.Request, response LookupResponse) {
+	switch ResponseFormat(r) {
+	case "text":
+		TextResponse(w, response)
+	case "zone":
+		ZoneResponse(w, response)
+	case "csv":
+		CSVResponse(w, exportFilename(response, "csv"), ExportRows(response))
+	case "ndjson":
+		NDJSONResponse(w, exportFilename(response, "ndjson"), ExportRows(response))
+	default:
+		JSONResponse(w, response)
 	}
-	wg.Wait()
-	response.TotalDuration = time.Since(lookupStart)
-	response.TotalDurationString = response.TotalDuration.String()
-	JSONResponse(w, response)
 }
 
 func DNSTypesEndpoint(w http.ResponseWriter, r *http.Request) {
 	// This function can be used to return the DNS types supported by the container.
 	// For now, it returns a placeholder string.
+	if QueryBool(r.URL.Query(), "codes") {
+		JSONResponse(w, DNSTypeCodes())
+		return
+	}
 	dnsTypes := make([]string, 0, len(dnsTypes))
 	for k := range dns.StringToType {
 		dnsTypes = append(dnsTypes, k)
@@ -240,6 +226,6 @@ func DoTQuery(domain string, qtype uint16, server string) (*dns.Msg, time.Durati
 	}
 
 	// server should be "host:853" (853 is the default DoT port)
-	resp, rtt, err := client.Exchange(m, server)
+	resp, rtt, err := client.Exchange(PadMsg(m, queryPaddingBlock), server)
 	return resp, rtt, err
 }
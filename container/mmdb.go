@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// mmdbMetadataMarker precedes the metadata map at the end of a MaxMind DB file.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbMaxDepth bounds the nesting of maps and arrays, so a crafted file cannot exhaust the stack.
+const mmdbMaxDepth = 512
+
+// MMDB is a read-only MaxMind DB file, the format used by MaxMind and IPinfo databases.
+type MMDB struct {
+	buf          []byte
+	data         []byte
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	ipv4Start    uint
+	DatabaseType string
+}
+
+// OpenMMDB reads the whole database into memory.
+func OpenMMDB(path string) (*MMDB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewMMDB(buf)
+}
+
+// NewMMDB parses a database held in memory.
+func NewMMDB(buf []byte) (*MMDB, error) {
+	start := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if start < 0 {
+		return nil, errors.New("invalid MMDB: metadata marker not found")
+	}
+	metaStart := start + len(mmdbMetadataMarker)
+	raw, _, err := (&mmdbDecoder{buf: buf[metaStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MMDB metadata: %w", err)
+	}
+	meta, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid MMDB metadata: not a map")
+	}
+	db := &MMDB{buf: buf}
+	db.nodeCount = mmdbUint(meta["node_count"])
+	db.recordSize = mmdbUint(meta["record_size"])
+	db.ipVersion = mmdbUint(meta["ip_version"])
+	db.DatabaseType, _ = meta["database_type"].(string)
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("invalid MMDB: unsupported record size %d", db.recordSize)
+	}
+	// Checking the node count first keeps the tree size from overflowing.
+	if db.nodeCount > uint(start) {
+		return nil, errors.New("invalid MMDB: search tree larger than file")
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(start) {
+		return nil, errors.New("invalid MMDB: search tree larger than file")
+	}
+	db.data = buf[treeSize+16 : start]
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+func mmdbUint(v any) uint {
+	switch n := v.(type) {
+	case uint64:
+		return uint(n)
+	case uint32:
+		return uint(n)
+	case uint16:
+		return uint(n)
+	}
+	return 0
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (db *MMDB) record(node uint, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		b := db.buf[off : off+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		off := node * 7
+		b := db.buf[off : off+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(db.buf[off : off+4]))
+	}
+}
+
+// Lookup returns the data stored for addr, or nil if the database has no entry for it.
+func (db *MMDB) Lookup(addr netip.Addr) (map[string]any, error) {
+	addr = addr.Unmap()
+	node, bits := uint(0), 128
+	raw := addr.AsSlice()
+	if addr.Is4() {
+		bits = 32
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < bits && node < db.nodeCount; i++ {
+		bit := uint(raw[i/8]>>(7-uint(i%8))) & 1
+		node = db.record(node, bit)
+	}
+	if node <= db.nodeCount {
+		return nil, nil
+	}
+	if node < db.nodeCount+16 || node-db.nodeCount-16 >= uint(len(db.data)) {
+		return nil, errors.New("invalid MMDB: data pointer out of range")
+	}
+	value, _, err := (&mmdbDecoder{buf: db.data}).decode(node - db.nodeCount - 16)
+	if err != nil {
+		return nil, err
+	}
+	result, _ := value.(map[string]any)
+	return result, nil
+}
+
+// mmdbDecoder decodes the data section format. Pointers are relative to the start of buf.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+func (d *mmdbDecoder) bytes(offset, size uint) ([]byte, error) {
+	if offset > uint(len(d.buf)) || size > uint(len(d.buf))-offset {
+		return nil, errors.New("unexpected end of data")
+	}
+	return d.buf[offset : offset+size], nil
+}
+
+// decode returns the value at offset and the offset following it.
+func (d *mmdbDecoder) decode(offset uint) (any, uint, error) {
+	return d.decodeAt(offset, 0)
+}
+
+func (d *mmdbDecoder) decodeAt(offset, depth uint) (any, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	ctrl, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	typeNum := uint(ctrl[0] >> 5)
+	if typeNum == 1 {
+		pointer, next, err := d.pointer(ctrl[0], offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// A pointer must not point to another pointer, which also rules out pointer loops.
+		target, err := d.bytes(pointer, 1)
+		if err != nil {
+			return nil, 0, errors.New("pointer out of range")
+		}
+		if target[0]>>5 == 1 {
+			return nil, 0, errors.New("pointer to a pointer")
+		}
+		value, _, err := d.decodeAt(pointer, depth+1)
+		return value, next, err
+	}
+	if typeNum == 0 {
+		ext, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typeNum = 7 + uint(ext[0])
+		offset++
+	}
+	size := uint(ctrl[0] & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytes(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+	switch typeNum {
+	case 2:
+		b, err := d.bytes(offset, size)
+		return string(b), offset + size, err
+	case 3:
+		b, err := d.bytes(offset, 8)
+		if err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset + 8, nil
+	case 4:
+		b, err := d.bytes(offset, size)
+		return bytes.Clone(b), offset + size, err
+	case 5, 6, 9:
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		switch typeNum {
+		case 5:
+			return uint16(n), offset + size, nil
+		case 6:
+			return uint32(n), offset + size, nil
+		}
+		return n, offset + size, nil
+	case 8:
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int32(n), offset + size, nil
+	case 10:
+		b, err := d.bytes(offset, size)
+		return new(big.Int).SetBytes(b), offset + size, err
+	case 7, 11:
+		// Every entry takes at least one byte, a larger size cannot fit the remaining data.
+		if size > uint(len(d.buf))-offset {
+			return nil, 0, errors.New("unexpected end of data")
+		}
+	}
+	switch typeNum {
+	case 7:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decodeAt(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			value, next, err := d.decodeAt(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case 11:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decodeAt(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case 14:
+		return size != 0, offset, nil
+	case 15:
+		b, err := d.bytes(offset, 4)
+		if err != nil {
+			return nil, 0, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), offset + 4, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported data type %d", typeNum)
+}
+
+// pointer returns the target of a pointer and the offset following it.
+func (d *mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl>>3) & 0x3
+	b, err := d.bytes(offset, size+1)
+	if err != nil {
+		return 0, 0, err
+	}
+	vvv := uint(ctrl & 0x7)
+	var pointer uint
+	switch size {
+	case 0:
+		pointer = vvv<<8 | uint(b[0])
+	case 1:
+		pointer = (vvv<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 2:
+		pointer = (vvv<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		pointer = uint(binary.BigEndian.Uint32(b))
+	}
+	return pointer, offset + size + 1, nil
+}
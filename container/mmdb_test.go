@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mmdbEncode writes a value in the MMDB data section format. Only the types and sizes the tests need are supported.
+func mmdbEncode(buf *bytes.Buffer, value any) {
+	control := func(typeNum int, size int) {
+		sizeBits, extra := size, []byte(nil)
+		if size >= 29 {
+			sizeBits, extra = 29, []byte{byte(size - 29)}
+		}
+		if typeNum <= 7 {
+			buf.WriteByte(byte(typeNum<<5 | sizeBits))
+		} else {
+			buf.WriteByte(byte(sizeBits))
+			buf.WriteByte(byte(typeNum - 7))
+		}
+		buf.Write(extra)
+	}
+	switch v := value.(type) {
+	case string:
+		control(2, len(v))
+		buf.WriteString(v)
+	case uint16:
+		control(5, 2)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		control(6, 4)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case bool:
+		if v {
+			control(14, 1)
+		} else {
+			control(14, 0)
+		}
+	case map[string]any:
+		control(7, len(v))
+		for key, item := range v {
+			mmdbEncode(buf, key)
+			mmdbEncode(buf, item)
+		}
+	}
+}
+
+// buildMMDB writes an IPv6 database with 32 bit records holding one map per prefix.
+func buildMMDB(t *testing.T, records map[string]map[string]any) []byte {
+	t.Helper()
+	type node struct{ child [2]int }
+	const empty, dataFlag = -1, 1 << 30
+	nodes := []node{{child: [2]int{empty, empty}}}
+	var data bytes.Buffer
+	for prefix, record := range records {
+		p := netip.MustParsePrefix(prefix)
+		addr, bits := p.Addr(), p.Bits()
+		if addr.Is4() {
+			addr, bits = netip.AddrFrom16(addr.As16()), bits+96
+			raw := addr.As16()
+			raw[10], raw[11] = 0, 0
+			addr = netip.AddrFrom16(raw)
+		}
+		raw := addr.As16()
+		offset := data.Len()
+		mmdbEncode(&data, record)
+		current := 0
+		for i := 0; i < bits; i++ {
+			bit := int(raw[i/8]>>(7-i%8)) & 1
+			if i == bits-1 {
+				nodes[current].child[bit] = dataFlag | offset
+				break
+			}
+			if nodes[current].child[bit] == empty {
+				nodes = append(nodes, node{child: [2]int{empty, empty}})
+				nodes[current].child[bit] = len(nodes) - 1
+			}
+			current = nodes[current].child[bit]
+		}
+	}
+	var out bytes.Buffer
+	for _, n := range nodes {
+		for _, child := range n.child {
+			value := uint32(len(nodes))
+			switch {
+			case child >= dataFlag:
+				value = uint32(len(nodes) + 16 + child&^dataFlag)
+			case child != empty:
+				value = uint32(child)
+			}
+			_ = binary.Write(&out, binary.BigEndian, value)
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.Write(mmdbMetadataMarker)
+	mmdbEncode(&out, map[string]any{
+		"node_count":    uint32(len(nodes)),
+		"record_size":   uint16(32),
+		"ip_version":    uint16(6),
+		"database_type": "Test-ASN-Country",
+	})
+	return out.Bytes()
+}
+
+func TestMMDB_Lookup(t *testing.T) {
+	db, err := NewMMDB(buildMMDB(t, map[string]map[string]any{
+		"192.0.2.0/24": {
+			"autonomous_system_number":       uint32(64500),
+			"autonomous_system_organization": "Example CDN",
+			"country":                        map[string]any{"iso_code": "JP"},
+		},
+		"2001:db8::/32": {"asn": "AS64501", "as_name": "Example Transit", "country_code": "DE", "continent_code": "EU"},
+	}))
+	if err != nil {
+		t.Fatalf("unable to parse database: %v", err)
+	}
+	if db.DatabaseType != "Test-ASN-Country" {
+		t.Errorf("unexpected database type %q", db.DatabaseType)
+	}
+	record, err := db.Lookup(netip.MustParseAddr("192.0.2.10"))
+	if err != nil || record == nil || record["autonomous_system_organization"] != "Example CDN" {
+		t.Errorf("unexpected record %v (%v)", record, err)
+	}
+	record, err = db.Lookup(netip.MustParseAddr("2001:db8::1"))
+	if err != nil || record == nil || record["as_name"] != "Example Transit" {
+		t.Errorf("unexpected record %v (%v)", record, err)
+	}
+	record, err = db.Lookup(netip.MustParseAddr("198.51.100.1"))
+	if err != nil || record != nil {
+		t.Errorf("expected no record, got %v (%v)", record, err)
+	}
+}
+
+func TestMMDB_Invalid(t *testing.T) {
+	if _, err := NewMMDB([]byte("not a database")); err == nil {
+		t.Errorf("expected error for missing metadata")
+	}
+	if _, err := OpenMMDB(filepath.Join(t.TempDir(), "missing.mmdb")); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestMMDBDecoder_Pointer(t *testing.T) {
+	// A map whose value is a pointer back to the string at offset 0.
+	var buf bytes.Buffer
+	mmdbEncode(&buf, "shared")
+	start := buf.Len()
+	buf.WriteByte(7<<5 | 1)
+	mmdbEncode(&buf, "key")
+	buf.Write([]byte{1 << 5, 0})
+	value, _, err := (&mmdbDecoder{buf: buf.Bytes()}).decode(uint(start))
+	if err != nil {
+		t.Fatalf("unable to decode: %v", err)
+	}
+	if m, ok := value.(map[string]any); !ok || m["key"] != "shared" {
+		t.Errorf("unexpected value %v", value)
+	}
+}
+
+func TestMMDBDecoder_Malformed(t *testing.T) {
+	// Arrays are extended type 11, an array of one array repeated until the depth limit is exceeded.
+	nested := bytes.Repeat([]byte{1, 11 - 7}, mmdbMaxDepth+1)
+	nested = append(nested, 0, 11-7)
+	tests := map[string][]byte{
+		// Pointer at offset 0 pointing to itself.
+		"pointer loop": {1 << 5, 0},
+		// Pointer at offset 0 pointing to the pointer at offset 2.
+		"pointer to pointer":  {1 << 5, 2, 1 << 5, 0},
+		"pointer past end":    {1<<5 | 7, 0xFF},
+		"string past end":     {2<<5 | 10, 'a'},
+		"oversized map":       {7<<5 | 30, 0xFF, 0xFF},
+		"oversized array":     {30, 11 - 7, 0xFF, 0xFF},
+		"nested arrays":       nested,
+		"truncated extension": {0},
+	}
+	for name, buf := range tests {
+		if value, _, err := (&mmdbDecoder{buf: buf}).decode(0); err == nil {
+			t.Errorf("%s: decode() = %v, want an error", name, value)
+		}
+	}
+}
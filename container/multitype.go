@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// commonTypes are looked up for type=common.
+var commonTypes = []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeMX, dns.TypeTXT, dns.TypeNS, dns.TypeCAA}
+
+// MultiLookupResponse holds a separate lookup for every requested type, keyed by type.
+type MultiLookupResponse struct {
+	Question            string                    `json:"question"`
+	Types               []string                  `json:"types"`
+	Results             map[string]LookupResponse `json:"results"`
+	TotalDuration       time.Duration             `json:"total_duration"`
+	TotalDurationString string                    `json:"total_duration_string"`
+}
+
+// ParseTypes parses a comma separated list of record types, or "common" for the usual set.
+// Meta types such as AXFR are rejected.
+func ParseTypes(raw string) ([]uint16, error) {
+	if strings.EqualFold(raw, "common") {
+		return commonTypes, nil
+	}
+	var types []uint16
+	seen := map[uint16]bool{}
+	for _, name := range strings.Split(raw, ",") {
+		qtype, err := ParseType(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := ValidateType(qtype); err != nil {
+			return nil, err
+		}
+		if !seen[qtype] {
+			seen[qtype] = true
+			types = append(types, qtype)
+		}
+	}
+	return types, nil
+}
+
+// MultiLookup runs a lookup for every type concurrently, so every server gets all the questions at once.
+func MultiLookup(ctx context.Context, client *dns.Client, parsed *ParsedQuestion, servers []DNSServer) MultiLookupResponse {
+	start := time.Now()
+	response := MultiLookupResponse{
+		Question: parsed.Domain,
+		Types:    make([]string, len(parsed.Types)),
+		Results:  make(map[string]LookupResponse, len(parsed.Types)),
+	}
+	results := make([]LookupResponse, len(parsed.Types))
+	var wg sync.WaitGroup
+	for i, qtype := range parsed.Types {
+		response.Types[i] = dns.Type(qtype).String()
+		question := *parsed
+		question.Type, question.Types = qtype, []uint16{qtype}
+		wg.Add(1)
+		go func(i int, question *ParsedQuestion) {
+			defer wg.Done()
+			results[i] = Lookup(ctx, client, question, servers)
+		}(i, &question)
+	}
+	wg.Wait()
+	for i, result := range results {
+		response.Results[response.Types[i]] = result
+	}
+	response.TotalDuration = time.Since(start)
+	response.TotalDurationString = response.TotalDuration.String()
+	return response
+}
+
+// WriteMultiLookupResponse writes every lookup in the format requested by the client, in the order the types were requested.
+func WriteMultiLookupResponse(w http.ResponseWriter, r *http.Request, response MultiLookupResponse) {
+	filename := fmt.Sprintf("lookup-%s-%s", strings.TrimSuffix(response.Question, "."), strings.Join(response.Types, "_"))
+	switch ResponseFormat(r) {
+	case "text":
+		w.Header().Set("Content-Type", TextApplicationType)
+		w.WriteHeader(http.StatusOK)
+		for _, qtype := range response.Types {
+			writeTextLookup(w, response.Results[qtype])
+			_, _ = fmt.Fprintln(w)
+		}
+	case "zone":
+		w.Header().Set("Content-Type", TextApplicationType)
+		w.WriteHeader(http.StatusOK)
+		for _, qtype := range response.Types {
+			writeZoneLookup(w, response.Results[qtype])
+			_, _ = fmt.Fprintln(w)
+		}
+	case "csv":
+		CSVResponse(w, filename+".csv", response.ExportRows())
+	case "ndjson":
+		NDJSONResponse(w, filename+".ndjson", response.ExportRows())
+	default:
+		JSONResponse(w, response)
+	}
+}
+
+// ExportRows flattens every lookup in the order the types were requested.
+func (m MultiLookupResponse) ExportRows() []ExportRow {
+	rows := []ExportRow{}
+	for _, qtype := range m.Types {
+		rows = append(rows, ExportRows(m.Results[qtype])...)
+	}
+	return rows
+}
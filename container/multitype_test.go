@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseTypes(t *testing.T) {
+	types, err := ParseTypes("A, AAAA,MX,A")
+	if err != nil {
+		t.Fatalf("ParseTypes() error = %v", err)
+	}
+	if !slices.Equal(types, []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeMX}) {
+		t.Errorf("ParseTypes() = %v", types)
+	}
+	if types, _ := ParseTypes("common"); !slices.Equal(types, commonTypes) {
+		t.Errorf("ParseTypes(common) = %v", types)
+	}
+	if _, err := ParseTypes("A,BOGUS"); err == nil || err.Error() != "invalid DNS type: BOGUS" {
+		t.Errorf("ParseTypes(invalid) error = %v", err)
+	}
+}
+
+func TestParseURLQuery_MultipleTypes(t *testing.T) {
+	parsed, err := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com&type=MX,TXT"))
+	if err != nil {
+		t.Fatalf("ParseURLQuery() error = %v", err)
+	}
+	if parsed.Type != dns.TypeMX || len(parsed.Types) != 2 {
+		t.Errorf("Type = %d, Types = %v", parsed.Type, parsed.Types)
+	}
+	if _, err := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com&type=A,AAAA&expect=192.0.2.1")); err == nil {
+		t.Error("expected an error for expect with multiple types")
+	}
+}
+
+func TestResolveEndpoint_MultipleTypes(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "zone", zoneHandler(false,
+		"example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 60",
+		"example.com. 300 IN A 192.0.2.1",
+		"example.com. 600 IN MX 10 mail.example.com.",
+	)))
+
+	req := httptest.NewRequest(http.MethodGet, "/lookup?domain=example.com&type=A,MX,AAAA", nil)
+	rr := httptest.NewRecorder()
+	ResolveEndpoint(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var response MultiLookupResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !slices.Equal(response.Types, []string{"A", "MX", "AAAA"}) || len(response.Results) != 3 {
+		t.Fatalf("response = %+v", response)
+	}
+	if a := response.Results["A"].Answers[0]; a.TTL != 300 || a.Rcode != "NOERROR" {
+		t.Errorf("A answer = %+v", a)
+	}
+	if mx := response.Results["MX"].Answers[0]; mx.TTL != 600 || !slices.Equal(mx.Values, []string{"10 mail.example.com."}) {
+		t.Errorf("MX answer = %+v", mx)
+	}
+	if aaaa := response.Results["AAAA"].Answers[0]; aaaa.TTL != 60 || len(aaaa.Values) != 0 {
+		t.Errorf("AAAA answer = %+v, want NODATA with the negative TTL", aaaa)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/lookup?domain=example.com&type=A,MX&format=csv", nil)
+	rr = httptest.NewRecorder()
+	ResolveEndpoint(rr, req)
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(records) != 3 || records[1][4] != "A" || records[2][4] != "MX" {
+		t.Errorf("CSV rows = %v", records)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.Contains(cd, "lookup-example.com-A_MX.csv") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+}
+
+func TestResolveEndpoint_MultipleTypesFormats(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "zone", zoneHandler(false,
+		"example.com. 300 IN A 192.0.2.1",
+		"example.com. 600 IN MX 10 mail.example.com.",
+	)))
+
+	req := httptest.NewRequest(http.MethodGet, "/lookup?domain=example.com&type=A,MX&format=zone", nil)
+	rr := httptest.NewRecorder()
+	ResolveEndpoint(rr, req)
+	body := rr.Body.String()
+	a, mx := strings.Index(body, "; example.com. A\n"), strings.Index(body, "; example.com. MX\n")
+	if rr.Code != http.StatusOK || a < 0 || mx < a {
+		t.Fatalf("status = %d, body %s", rr.Code, body)
+	}
+	for _, record := range []string{"example.com.\t300\tIN\tA\t192.0.2.1", "example.com.\t600\tIN\tMX\t10 mail.example.com."} {
+		if !strings.Contains(body, record) {
+			t.Errorf("zone output is missing %q:\n%s", record, body)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/lookup?domain=example.com&type=A,MX&stream=ndjson", nil)
+	rr = httptest.NewRecorder()
+	ResolveEndpoint(rr, req)
+	var errBody ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &errBody); err != nil || rr.Code != http.StatusBadRequest || errBody.Code != ErrInvalidParameter {
+		t.Errorf("stream status = %d, body %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// queryPaddingBlock is the block size queries are padded to, as recommended by RFC 8467.
+const queryPaddingBlock = 128
+
+// isEncrypted reports whether the client sends its queries over TLS.
+func isEncrypted(client *dns.Client) bool {
+	return strings.HasSuffix(client.Net, "-tls")
+}
+
+// tlsRootCAs verifies the certificates of DNS over TLS servers, nil uses the system roots.
+var tlsRootCAs *x509.CertPool
+
+// UpstreamTransport returns the client and servers the question is fanned out to.
+// Over TLS only the servers with a TLS name are queried, on their TLS port.
+func UpstreamTransport(client *dns.Client, parsed *ParsedQuestion, servers []DNSServer) (*dns.Client, []DNSServer) {
+	if !parsed.TLS {
+		return client, servers
+	}
+	tlsClient := *client
+	tlsClient.Net = "tcp-tls"
+	tlsServers := make([]DNSServer, 0, len(servers))
+	for _, server := range servers {
+		if server.TLSName != "" {
+			server.Port = server.TLSPort
+			tlsServers = append(tlsServers, server)
+		}
+	}
+	return &tlsClient, tlsServers
+}
+
+// serverClient returns the client used for a single server, a TLS client verifies the name of the server.
+func serverClient(client *dns.Client, server DNSServer) *dns.Client {
+	if !isEncrypted(client) {
+		return client
+	}
+	tlsClient := *client
+	tlsClient.TLSConfig = &tls.Config{ServerName: server.TLSName, RootCAs: tlsRootCAs}
+	return &tlsClient
+}
+
+// PadMsg returns a copy of m with an EDNS padding option (RFC 7830) that makes its wire size a multiple of block.
+func PadMsg(m *dns.Msg, block int) *dns.Msg {
+	m = m.Copy()
+	opt := m.IsEdns0()
+	if opt == nil {
+		m.SetEdns0(dns.DefaultMsgSize, false)
+		opt = m.IsEdns0()
+	}
+	options := opt.Option[:0]
+	for _, option := range opt.Option {
+		if option.Option() != dns.EDNS0PADDING {
+			options = append(options, option)
+		}
+	}
+	opt.Option = options
+	// The padding option header takes 4 bytes before the padding itself.
+	size := m.Len() + 4
+	opt.Option = append(opt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, (block-size%block)%block)})
+	return m
+}
+
+// ResponsePadded reports whether the server padded its response.
+func ResponsePadded(msg *dns.Msg) bool {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, option := range opt.Option {
+		if option.Option() == dns.EDNS0PADDING {
+			return true
+		}
+	}
+	return false
+}
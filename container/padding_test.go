@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestPadMsg(t *testing.T) {
+	for _, name := range []string{"a.", "example.com.", "a-much-longer-name.with.several.labels.example.org."} {
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypeA)
+		padded := PadMsg(m, queryPaddingBlock)
+		wire, err := padded.Pack()
+		if err != nil {
+			t.Fatalf("Pack() error = %v", err)
+		}
+		if len(wire)%queryPaddingBlock != 0 {
+			t.Errorf("%s: padded size = %d, want a multiple of %d", name, len(wire), queryPaddingBlock)
+		}
+		if m.IsEdns0() != nil {
+			t.Errorf("%s: PadMsg() modified the original message", name)
+		}
+		// Padding an already padded message keeps a single option.
+		if repadded := PadMsg(padded, queryPaddingBlock); len(repadded.IsEdns0().Option) != 1 || repadded.Len() != padded.Len() {
+			t.Errorf("%s: repadded = %v", name, repadded)
+		}
+	}
+}
+
+func TestResponsePadded(t *testing.T) {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	if ResponsePadded(m) {
+		t.Error("ResponsePadded() = true without an OPT record")
+	}
+	if !ResponsePadded(PadMsg(m, queryPaddingBlock)) {
+		t.Error("ResponsePadded() = false for a padded message")
+	}
+}
+
+// startTestTLSServer runs an in-process DNS over TLS server for tlsName answering with handler,
+// and trusts its certificate for the duration of the test.
+func startTestTLSServer(t *testing.T, name, tlsName string, handler dns.HandlerFunc) DNSServer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{tlsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unable to parse certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	orig := tlsRootCAs
+	tlsRootCAs = roots
+	t.Cleanup(func() { tlsRootCAs = orig })
+
+	config := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{Listener: listener, Net: "tcp-tls", Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+	addr := listener.Addr().(*net.TCPAddr)
+	return DNSServer{Name: name, Address: addr.IP.String(), Port: 53, TLSName: tlsName, TLSPort: addr.Port}
+}
+
+func TestLookup_TLSPadding(t *testing.T) {
+	var queryPadded atomic.Bool
+	server := startTestTLSServer(t, "tls", "dns.test", func(w dns.ResponseWriter, r *dns.Msg) {
+		queryPadded.Store(ResponsePadded(r) && r.Len()%queryPaddingBlock == 0)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, mustRR(t, "example.com. 300 IN A 192.0.2.1"))
+		_ = w.WriteMsg(PadMsg(m, 468))
+	})
+	plain := DNSServer{Name: "plain", Address: "127.0.0.1", Port: 1}
+
+	parsed, err := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com&type=A&transport=tls"))
+	if err != nil {
+		t.Fatalf("ParseURLQuery() error = %v", err)
+	}
+	parsed.Domain = dns.Fqdn(parsed.Domain)
+	response := Lookup(context.Background(), NewClient(), parsed, []DNSServer{server, plain})
+	if response.Transport != "tls" || len(response.Answers) != 1 {
+		t.Fatalf("response = %+v, want a single TLS answer", response)
+	}
+	answer := response.Answers[0]
+	if answer.DNSServer != "tls" || !slices.Equal(answer.Values, []string{"192.0.2.1"}) {
+		t.Errorf("answer = %+v", answer)
+	}
+	if !queryPadded.Load() {
+		t.Error("the query was not padded to a multiple of the block size")
+	}
+	if !answer.Padded {
+		t.Error("Padded = false for a padded response")
+	}
+}
+
+func TestLookup_TLSChaseChain(t *testing.T) {
+	oneHop := zoneHandler(false,
+		"www.example.com. 300 IN CNAME cdn.example.net.",
+		"cdn.example.net. 60 IN A 192.0.2.1",
+	)
+	server := startTestTLSServer(t, "tls", "dns.test", oneHop)
+
+	parsed, _ := ParseURLQuery(mustParseURL(t, "/lookup?domain=www.example.com.&type=A&chase=true&transport=tls"))
+	response := Lookup(context.Background(), NewClient(), parsed, []DNSServer{server})
+	if len(response.Answers) != 1 {
+		t.Fatalf("response = %+v, want a single TLS answer", response)
+	}
+	if chain := response.Answers[0].CNAMEChain; chain == nil || chain.Status != ChainComplete {
+		t.Errorf("expected the chain to be chased over TLS, got %+v", chain)
+	}
+}
+
+func TestParseURLQuery_Transport(t *testing.T) {
+	if _, err := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com&type=A&transport=quic")); ErrorCode(err) != ErrInvalidParameter {
+		t.Errorf("transport=quic error = %v, want %s", err, ErrInvalidParameter)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	Propagated = "propagated"
+	Stale      = "stale"
+	Missing    = "missing"
+)
+
+// PropagationSummary compares every resolver against the expected values.
+type PropagationSummary struct {
+	Source                   string   `json:"source"`
+	AuthoritativeServer      string   `json:"authoritative_server,omitempty"`
+	Expected                 []string `json:"expected"`
+	Propagated               int      `json:"propagated"`
+	Stale                    int      `json:"stale"`
+	Missing                  int      `json:"missing"`
+	PercentPropagated        float64  `json:"percent_propagated"`
+	EstimatedCompleteSeconds int      `json:"estimated_complete_seconds"`
+	EstimatedCompleteAt      string   `json:"estimated_complete_at"`
+}
+
+// ParseExpected converts the expect query values into canonical rdata for the question type.
+// Values may be repeated or comma separated, except for TXT records which may contain commas.
+func ParseExpected(domain string, qtype uint16, values []string) ([]string, error) {
+	expected := make([]string, 0, len(values))
+	for _, value := range values {
+		parts := []string{value}
+		if qtype != dns.TypeTXT {
+			parts = strings.Split(value, ",")
+		}
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			rr, err := dns.NewRR(fmt.Sprintf("%s 0 IN %s %s", dns.Fqdn(domain), dns.Type(qtype).String(), part))
+			if err != nil || rr == nil {
+				return nil, fmt.Errorf("invalid expected value for %s: %s", dns.Type(qtype).String(), part)
+			}
+			expected = append(expected, CanonicalValue(rr))
+		}
+	}
+	slices.Sort(expected)
+	return slices.Compact(expected), nil
+}
+
+// finalValues returns the sorted canonical rdata of the records of the queried type.
+func finalValues(msg *dns.Msg, qtype uint16) []string {
+	values := []string{}
+	for _, rr := range msg.Answer {
+		if rr.Header().Rrtype == qtype {
+			values = append(values, CanonicalValue(rr))
+		}
+	}
+	slices.Sort(values)
+	return slices.Compact(values)
+}
+
+// CheckPropagation marks every answer as propagated, stale or missing. Stale answers are expected
+// to update once their TTL runs out, missing answers once the cached negative answer expires.
+func CheckPropagation(answers []DNSServerResponse, expected []string, qtype uint16) *PropagationSummary {
+	summary := &PropagationSummary{Source: "expect", Expected: expected}
+	for i := range answers {
+		answer := &answers[i]
+		answer.Propagation, answer.PropagationETA = Missing, nil
+		if answer.msg == nil {
+			summary.Missing++
+			continue
+		}
+		values := finalValues(answer.msg, qtype)
+		var eta int
+		switch {
+		case slices.Equal(values, expected):
+			answer.Propagation = Propagated
+			summary.Propagated++
+			continue
+		case len(values) == 0:
+			eta = NegativeTTL(answer.msg)
+			summary.Missing++
+		default:
+			answer.Propagation = Stale
+			eta = FinalTTL(answer.msg, qtype)
+			summary.Stale++
+		}
+		answer.PropagationETA = &eta
+		summary.EstimatedCompleteSeconds = max(summary.EstimatedCompleteSeconds, eta)
+	}
+	if len(answers) > 0 {
+		summary.PercentPropagated = math.Round(float64(summary.Propagated)/float64(len(answers))*1000) / 10
+	}
+	summary.EstimatedCompleteAt = time.Now().UTC().Add(time.Duration(summary.EstimatedCompleteSeconds) * time.Second).Format(time.RFC3339)
+	return summary
+}
+
+// PropagationEndpoint uses the authoritative answer as the expected value and checks every resolver against it.
+func PropagationEndpoint(w http.ResponseWriter, r *http.Request) {
+	parsed, err := ParseURLQuery(r.URL)
+	if err != nil {
+		QueryErrorResponse(w, err)
+		return
+	}
+	parsed.Domain = dns.Fqdn(parsed.Domain)
+	if len(dnsServers) == 0 {
+		ErrorJSONResponse(w, http.StatusInternalServerError, ErrNoServers, "No DNS servers configured")
+		return
+	}
+	client := NewClient()
+	auth, authServer, err := LookupAuthoritative(r.Context(), client, dnsServers[0], parsed.Domain, parsed.Type)
+	if err != nil {
+		log.Printf("Error querying authoritative servers for %s: %v", parsed.Domain, err)
+		ErrorJSONResponse(w, http.StatusBadGateway, ErrUpstream, fmt.Sprintf("Unable to query authoritative servers: %v", err))
+		return
+	}
+	response := Lookup(r.Context(), client, parsed, dnsServers)
+	response.Propagation = CheckPropagation(response.Answers, finalValues(auth, parsed.Type), parsed.Type)
+	response.Propagation.Source = "authoritative"
+	response.Propagation.AuthoritativeServer = authServer.String()
+	WriteLookupResponse(w, r, response)
+}
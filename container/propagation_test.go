@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseExpected(t *testing.T) {
+	expected, err := ParseExpected("example.com", dns.TypeAAAA, []string{"2001:DB8::0001, 2001:db8::2", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(expected, []string{"2001:db8::1", "2001:db8::2"}) {
+		t.Errorf("unexpected values %v", expected)
+	}
+	if _, err := ParseExpected("example.com", dns.TypeA, []string{"not-an-ip"}); err == nil {
+		t.Errorf("expected error for invalid A value")
+	}
+	expected, _ = ParseExpected("example.com", dns.TypeTXT, []string{`"a,b"`})
+	if !slices.Equal(expected, []string{`"a,b"`}) {
+		t.Errorf("unexpected TXT values %v", expected)
+	}
+}
+
+func TestResolve_Expect(t *testing.T) {
+	soa := "example.com. 3600 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 60"
+	useDNSServers(t,
+		startTestDNSServer(t, "New", staticHandler("example.com. 300 IN A 192.0.2.1")),
+		startTestDNSServer(t, "Old", staticHandler("example.com. 120 IN A 198.51.100.1")),
+		startTestDNSServer(t, "Empty", zoneHandler(false, soa)),
+	)
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A&expect=192.0.2.1", nil)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	var response LookupResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&response); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	status := map[string]string{}
+	for _, answer := range response.Answers {
+		status[answer.DNSServer] = answer.Propagation
+	}
+	if status["New"] != Propagated || status["Old"] != Stale || status["Empty"] != Missing {
+		t.Errorf("unexpected propagation %v", status)
+	}
+	summary := response.Propagation
+	if summary == nil || summary.Propagated != 1 || summary.Stale != 1 || summary.Missing != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if summary.EstimatedCompleteSeconds != 120 {
+		t.Errorf("expected completion in 120s, got %d", summary.EstimatedCompleteSeconds)
+	}
+}
+
+func TestPropagationEndpoint(t *testing.T) {
+	auth := startTestDNSServer(t, "ns1.example.com.", zoneHandler(true, "example.com. 300 IN A 192.0.2.1"))
+	resolver := startTestDNSServer(t, "Resolver", zoneHandler(false,
+		"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 900",
+		"example.com. 3600 IN NS ns1.example.com.",
+		"ns1.example.com. 3600 IN A 127.0.0.1",
+		"example.com. 100 IN A 198.51.100.1",
+	))
+	useDNSServers(t, resolver)
+	origPort := authoritativePort
+	authoritativePort = auth.Port
+	t.Cleanup(func() { authoritativePort = origPort })
+
+	req := httptest.NewRequest("GET", "/api/v1/propagation?domain=example.com&type=A", nil)
+	w := httptest.NewRecorder()
+	PropagationEndpoint(w, req)
+	var response LookupResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&response); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	summary := response.Propagation
+	if summary == nil || summary.Source != "authoritative" || !slices.Equal(summary.Expected, []string{"192.0.2.1"}) {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if response.Answers[0].Propagation != Stale || *response.Answers[0].PropagationETA != 100 {
+		t.Errorf("unexpected answer %+v", response.Answers[0])
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// FCrDNSResult is the forward-confirmed reverse DNS check of a resolver's PTR answer.
+type FCrDNSResult struct {
+	Confirmed   bool     `json:"confirmed"`
+	Names       []string `json:"confirmed_names"`
+	Unconfirmed []string `json:"unconfirmed_names,omitempty"`
+}
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name of an address.
+func ReverseName(ip string) (netip.Addr, string, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return netip.Addr{}, "", fmt.Errorf("invalid ip: %s", ip)
+	}
+	addr = addr.Unmap()
+	name, err := dns.ReverseAddr(addr.String())
+	if err != nil {
+		return netip.Addr{}, "", fmt.Errorf("invalid ip: %s", ip)
+	}
+	return addr, name, nil
+}
+
+// CheckFCrDNS resolves the PTR targets of every answer through the same server and checks they point back at addr.
+func CheckFCrDNS(ctx context.Context, client *dns.Client, answers []DNSServerResponse, addr netip.Addr) {
+	qtype := dns.TypeA
+	if addr.Is6() {
+		qtype = dns.TypeAAAA
+	}
+	for i := range answers {
+		answer := &answers[i]
+		if answer.msg == nil {
+			continue
+		}
+		result := &FCrDNSResult{Names: []string{}}
+		for _, rr := range answer.msg.Answer {
+			ptr, ok := rr.(*dns.PTR)
+			if !ok {
+				continue
+			}
+			m := new(dns.Msg)
+			m.SetQuestion(dns.Fqdn(ptr.Ptr), qtype)
+			m.RecursionDesired = true
+			if forwardMatches(ctx, client, m, answer.server, addr) {
+				result.Names = append(result.Names, ptr.Ptr)
+			} else {
+				result.Unconfirmed = append(result.Unconfirmed, ptr.Ptr)
+			}
+		}
+		result.Confirmed = len(result.Names) > 0
+		answer.FCrDNS = result
+	}
+}
+
+func forwardMatches(ctx context.Context, client *dns.Client, m *dns.Msg, server DNSServer, addr netip.Addr) bool {
+	resp, _, err := ExchangeContext(ctx, serverClient(client, server), m, server.AddressString())
+	if err != nil {
+		return false
+	}
+	var addresses []netip.Addr
+	for _, rr := range resp.Answer {
+		switch v := rr.(type) {
+		case *dns.A:
+			if a, ok := netip.AddrFromSlice(v.A.To4()); ok {
+				addresses = append(addresses, a)
+			}
+		case *dns.AAAA:
+			if a, ok := netip.AddrFromSlice(v.AAAA); ok {
+				addresses = append(addresses, a)
+			}
+		}
+	}
+	return slices.Contains(addresses, addr)
+}
+
+// ReverseEndpoint looks up the PTR records of the ip query parameter. Add fcrdns=true to confirm the names.
+func ReverseEndpoint(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("ip") == "" {
+		QueryErrorResponse(w, questionErrorf(ErrMissingIP, "missing 'ip' parameter in query"))
+		return
+	}
+	ResolveEndpoint(w, r)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestReverseName(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1":          "1.2.0.192.in-addr.arpa.",
+		"::ffff:192.0.2.1":   "1.2.0.192.in-addr.arpa.",
+		"2001:db8::567:89ab": "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+	}
+	for ip, want := range tests {
+		_, name, err := ReverseName(ip)
+		if err != nil {
+			t.Errorf("ReverseName(%q) error = %v", ip, err)
+			continue
+		}
+		if name != want {
+			t.Errorf("ReverseName(%q) = %q, want %q", ip, name, want)
+		}
+	}
+	if _, _, err := ReverseName("300.1.1.1"); err == nil || err.Error() != "invalid ip: 300.1.1.1" {
+		t.Errorf("ReverseName(invalid) error = %v", err)
+	}
+}
+
+func TestParseURLQuery_IP(t *testing.T) {
+	parsed, err := ParseURLQuery(mustParseURL(t, "/lookup?ip=192.0.2.1"))
+	if err != nil {
+		t.Fatalf("ParseURLQuery() error = %v", err)
+	}
+	if parsed.Domain != "1.2.0.192.in-addr.arpa." || parsed.Type != dns.TypePTR || parsed.IP.String() != "192.0.2.1" {
+		t.Errorf("parsed = %+v, want a PTR question for the reverse name", parsed)
+	}
+}
+
+func TestReverseEndpoint_FCrDNS(t *testing.T) {
+	useDNSServers(t,
+		startTestDNSServer(t, "confirmed", zoneHandler(false,
+			"1.2.0.192.in-addr.arpa. 300 IN PTR host.example.com.",
+			"host.example.com. 300 IN A 192.0.2.1",
+		)),
+		startTestDNSServer(t, "spoofed", zoneHandler(false,
+			"1.2.0.192.in-addr.arpa. 300 IN PTR mail.bank.example.",
+			"mail.bank.example. 300 IN A 198.51.100.7",
+		)),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/reverse?ip=192.0.2.1&fcrdns=true&sort=name", nil)
+	rr := httptest.NewRecorder()
+	ReverseEndpoint(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var response LookupResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if response.Question != "1.2.0.192.in-addr.arpa." || response.Type != "PTR" || len(response.Answers) != 2 {
+		t.Fatalf("response = %+v", response)
+	}
+	confirmed, spoofed := response.Answers[0], response.Answers[1]
+	if confirmed.FCrDNS == nil || !confirmed.FCrDNS.Confirmed || confirmed.FCrDNS.Names[0] != "host.example.com." {
+		t.Errorf("confirmed FCrDNS = %+v", confirmed.FCrDNS)
+	}
+	if spoofed.FCrDNS == nil || spoofed.FCrDNS.Confirmed || spoofed.FCrDNS.Unconfirmed[0] != "mail.bank.example." {
+		t.Errorf("spoofed FCrDNS = %+v", spoofed.FCrDNS)
+	}
+}
+
+func TestReverseEndpoint_MissingIP(t *testing.T) {
+	rr := httptest.NewRecorder()
+	ReverseEndpoint(rr, httptest.NewRequest(http.MethodGet, "/reverse?domain=example.com&type=A", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rr.Code)
+	}
+}
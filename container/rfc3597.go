@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+// DNSTypeCode is a record type with its numeric code and RFC 3597 generic name.
+type DNSTypeCode struct {
+	Name    string `json:"name"`
+	Code    uint16 `json:"code"`
+	Generic string `json:"generic"`
+}
+
+// DNSTypeCodes lists every type known to the DNS library ordered by code.
+func DNSTypeCodes() []DNSTypeCode {
+	codes := make([]DNSTypeCode, 0, len(dns.TypeToString))
+	for code, name := range dns.TypeToString {
+		codes = append(codes, DNSTypeCode{Name: name, Code: code, Generic: "TYPE" + strconv.Itoa(int(code))})
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+// GenericRdata returns the base64 encoded rdata of a record the DNS library does not model.
+// Its presentation value is already in the RFC 3597 \# length hex form.
+func GenericRdata(rr dns.RR) (string, bool) {
+	unknown, ok := rr.(*dns.RFC3597)
+	if !ok {
+		return "", false
+	}
+	rdata, err := hex.DecodeString(unknown.Rdata)
+	if err != nil {
+		return "", false
+	}
+	return base64.StdEncoding.EncodeToString(rdata), true
+}
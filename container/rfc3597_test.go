@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// unknownTypeHandler answers every question with a record of the queried type in RFC 3597 form.
+func unknownTypeHandler(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	q := r.Question[0]
+	m.Answer = append(m.Answer, &dns.RFC3597{
+		Hdr:   dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 300},
+		Rdata: "0a000001",
+	})
+	_ = w.WriteMsg(m)
+}
+
+func TestResolve_UnknownType(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "unknown", unknownTypeHandler))
+
+	req := httptest.NewRequest(http.MethodGet, "/lookup?domain=example.com&type=TYPE65400&expect=%5C%23+4+0a000001", nil)
+	rr := httptest.NewRecorder()
+	ResolveEndpoint(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var response LookupResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if response.Type != "TYPE65400" || len(response.Answers) != 1 {
+		t.Fatalf("response = %+v", response)
+	}
+	answer := response.Answers[0]
+	if len(answer.Values) != 1 || answer.Values[0] != `\# 4 0a000001` {
+		t.Errorf("Values = %v, want the generic rdata", answer.Values)
+	}
+	if record := answer.Records[0]; record.Type != "TYPE65400" || record.RdataBase64 != "CgAAAQ==" {
+		t.Errorf("record = %+v", record)
+	}
+	if answer.Propagation != Propagated {
+		t.Errorf("Propagation = %q, want the generic expect value to match", answer.Propagation)
+	}
+}
+
+func TestGenericRdata_KnownType(t *testing.T) {
+	if _, ok := GenericRdata(mustRR(t, "example.com. 300 IN A 192.0.2.1")); ok {
+		t.Error("GenericRdata() reported a known type as generic")
+	}
+}
+
+func TestDNSTypesEndpoint_Codes(t *testing.T) {
+	rr := httptest.NewRecorder()
+	DNSTypesEndpoint(rr, httptest.NewRequest(http.MethodGet, "/dns_types?codes=true", nil))
+	var codes []DNSTypeCode
+	if err := json.Unmarshal(rr.Body.Bytes(), &codes); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(codes) == 0 || codes[0].Code > codes[len(codes)-1].Code {
+		t.Fatalf("codes are not ordered: %v", codes)
+	}
+	for _, code := range codes {
+		if code.Name == "AAAA" && (code.Code != 28 || code.Generic != "TYPE28") {
+			t.Errorf("AAAA = %+v", code)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const EventStreamType = "text/event-stream"
+
+// LookupSummary is sent as the final event of a streamed lookup.
+type LookupSummary struct {
+	Question            string        `json:"question"`
+	Type                string        `json:"type"`
+	Location            string        `json:"location"`
+	Region              string        `json:"region"`
+	Country             string        `json:"country"`
+	Servers             int           `json:"servers"`
+	Answered            int           `json:"answered"`
+	Failed              int           `json:"failed"`
+	Incomplete          []string      `json:"incomplete,omitempty"`
+	Consensus           *Consensus    `json:"consensus"`
+	TotalDuration       time.Duration `json:"total_duration"`
+	TotalDurationString string        `json:"total_duration_string"`
+}
+
+// StreamEvent is a single line of a chunked NDJSON stream.
+type StreamEvent struct {
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+// StreamFormat returns "sse" or "ndjson" when the client asked for a streamed lookup, otherwise "".
+func StreamFormat(r *http.Request) string {
+	switch strings.ToLower(r.URL.Query().Get("stream")) {
+	case "sse", "true", "1":
+		return "sse"
+	case "ndjson":
+		return "ndjson"
+	}
+	if strings.Contains(r.Header.Get("Accept"), EventStreamType) {
+		return "sse"
+	}
+	return ""
+}
+
+// StreamUnsupported lists the requested options a streamed lookup cannot apply,
+// they need every answer before the first one can be written.
+func StreamUnsupported(parsed *ParsedQuestion) []string {
+	var options []string
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"samples", parsed.Samples > 1},
+		{"ttl_check", parsed.TTLCheck},
+		{"hijack_check", parsed.HijackCheck},
+		{"dnssec", parsed.DNSSEC},
+		{"expect", len(parsed.Expected) > 0},
+		{"chase", parsed.Chase},
+		{"fcrdns", parsed.FCrDNS},
+		{"sort", parsed.Sort != ""},
+	} {
+		if option.set {
+			options = append(options, option.name)
+		}
+	}
+	return options
+}
+
+// StreamResponse writes every answer as soon as it is received followed by a summary event.
+func StreamResponse(w http.ResponseWriter, format string, response LookupResponse, servers int, answers <-chan DNSServerResponse) {
+	start := time.Now()
+	flusher, _ := w.(http.Flusher)
+	if format == "sse" {
+		w.Header().Set("Content-Type", EventStreamType)
+	} else {
+		w.Header().Set("Content-Type", NDJSONApplicationType)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	summary := LookupSummary{
+		Question: response.Question,
+		Type:     response.Type,
+		Location: response.Location,
+		Region:   response.Region,
+		Country:  response.Country,
+		Servers:  servers,
+	}
+	id := 0
+	send := func(event string, data any) error {
+		var err error
+		if format == "sse" {
+			var body []byte
+			body, err = json.Marshal(data)
+			if err == nil {
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, body)
+			}
+		} else {
+			err = json.NewEncoder(w).Encode(StreamEvent{Event: event, Data: data})
+		}
+		id++
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return err
+	}
+	received := make([]DNSServerResponse, 0, servers)
+	for answer := range answers {
+		if answer.Incomplete {
+			summary.Incomplete = append(summary.Incomplete, answer.DNSServer)
+			continue
+		}
+		received = append(received, answer)
+		summary.Answered++
+		if err := send("answer", answer); err != nil {
+			log.Printf("Error streaming answer from %s: %v", answer.DNSServer, err)
+		}
+	}
+	summary.Failed = summary.Servers - summary.Answered - len(summary.Incomplete)
+	summary.Consensus = BuildConsensus(received)
+	summary.TotalDuration = time.Since(start)
+	summary.TotalDurationString = summary.TotalDuration.String()
+	if err := send("summary", summary); err != nil {
+		log.Printf("Error streaming summary: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestResolve_StreamSSE(t *testing.T) {
+	slow := func(w dns.ResponseWriter, r *dns.Msg) {
+		time.Sleep(100 * time.Millisecond)
+		staticHandler("example.com. 300 IN A 192.0.2.2")(w, r)
+	}
+	useDNSServers(t,
+		startTestDNSServer(t, "Slow", slow),
+		startTestDNSServer(t, "Fast", staticHandler("example.com. 300 IN A 192.0.2.1")),
+	)
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A", nil)
+	req.Header.Set("Accept", EventStreamType)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	resp := w.Result()
+	if ct := resp.Header.Get("Content-Type"); ct != EventStreamType {
+		t.Errorf("expected Content-Type %q, got %q", EventStreamType, ct)
+	}
+
+	var events, data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if event, ok := strings.CutPrefix(line, "event: "); ok {
+			events = append(events, event)
+		}
+		if d, ok := strings.CutPrefix(line, "data: "); ok {
+			data = append(data, d)
+		}
+	}
+	if strings.Join(events, ",") != "answer,answer,summary" {
+		t.Fatalf("unexpected events %v", events)
+	}
+	var first DNSServerResponse
+	if err := json.Unmarshal([]byte(data[0]), &first); err != nil {
+		t.Fatalf("unable to decode answer: %v", err)
+	}
+	if first.DNSServer != "Fast" {
+		t.Errorf("expected the fast server to be streamed first, got %s", first.DNSServer)
+	}
+	var summary LookupSummary
+	if err := json.Unmarshal([]byte(data[2]), &summary); err != nil {
+		t.Fatalf("unable to decode summary: %v", err)
+	}
+	if summary.Servers != 2 || summary.Answered != 2 || summary.Failed != 0 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestResolve_StreamNDJSON(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "Local", staticHandler("example.com. 300 IN A 192.0.2.1")))
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A&stream=ndjson", nil)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	decoder := json.NewDecoder(w.Result().Body)
+	var kinds []string
+	for decoder.More() {
+		var event StreamEvent
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatalf("unable to decode event: %v", err)
+		}
+		kinds = append(kinds, event.Event)
+	}
+	if strings.Join(kinds, ",") != "answer,summary" {
+		t.Errorf("unexpected events %v", kinds)
+	}
+}
+
+func TestResolve_StreamUnsupportedOptions(t *testing.T) {
+	useDNSServers(t, startTestDNSServer(t, "Local", staticHandler("example.com. 300 IN A 192.0.2.1")))
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A&stream=sse&ttl_check=true&sort=answer", nil)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	var body ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON error: %v", err)
+	}
+	if w.Code != http.StatusBadRequest || body.Code != ErrInvalidParameter || !strings.HasSuffix(body.Error, "stream does not support ttl_check, sort") {
+		t.Errorf("status = %d, error = %+v", w.Code, body)
+	}
+}
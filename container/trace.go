@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxTraceSteps bounds the number of servers queried while walking referrals.
+const maxTraceSteps = 30
+
+const (
+	TraceAnswer    = "answer"
+	TraceNXDomain  = "nxdomain"
+	TraceNoData    = "nodata"
+	TraceCNAME     = "cname"
+	TraceLame      = "lame"
+	TraceNoServers = "no_servers"
+	TraceTooLong   = "too_long"
+)
+
+// rootHints are the IPv4 addresses of the root servers.
+var rootHints = []DNSServer{
+	{Name: "a.root-servers.net.", Address: "198.41.0.4", Port: 53},
+	{Name: "b.root-servers.net.", Address: "170.247.170.2", Port: 53},
+	{Name: "c.root-servers.net.", Address: "192.33.4.12", Port: 53},
+	{Name: "d.root-servers.net.", Address: "199.7.91.13", Port: 53},
+	{Name: "e.root-servers.net.", Address: "192.203.230.10", Port: 53},
+	{Name: "f.root-servers.net.", Address: "192.5.5.241", Port: 53},
+	{Name: "g.root-servers.net.", Address: "192.112.36.4", Port: 53},
+	{Name: "h.root-servers.net.", Address: "198.97.190.53", Port: 53},
+	{Name: "i.root-servers.net.", Address: "192.36.148.17", Port: 53},
+	{Name: "j.root-servers.net.", Address: "192.58.128.30", Port: 53},
+	{Name: "k.root-servers.net.", Address: "193.0.14.129", Port: 53},
+	{Name: "l.root-servers.net.", Address: "199.7.83.42", Port: 53},
+	{Name: "m.root-servers.net.", Address: "202.12.27.33", Port: 53},
+}
+
+// TraceStep is a single query made while walking down from the root.
+type TraceStep struct {
+	Zone           string        `json:"zone"`
+	Server         string        `json:"server"`
+	Address        string        `json:"server_address"`
+	Rcode          string        `json:"rcode,omitempty"`
+	ReferralZone   string        `json:"referral_zone,omitempty"`
+	ReferralNS     []string      `json:"referral_ns,omitempty"`
+	Glue           []string      `json:"glue,omitempty"`
+	DS             bool          `json:"ds"`
+	Answer         []string      `json:"answer,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	Duration       time.Duration `json:"duration"`
+	DurationString string        `json:"duration_string"`
+
+	msg *dns.Msg
+}
+
+// TraceResponse is the delegation path from the root to the answer.
+type TraceResponse struct {
+	Question            string        `json:"question"`
+	Type                string        `json:"type"`
+	Status              string        `json:"status"`
+	Steps               []TraceStep   `json:"steps"`
+	TotalDuration       time.Duration `json:"total_duration"`
+	TotalDurationString string        `json:"total_duration_string"`
+}
+
+// Trace resolves name iteratively starting at the root hints, like dig +trace.
+// Nameservers without glue are resolved through the resolver.
+func Trace(ctx context.Context, client *dns.Client, resolver DNSServer, name string, qtype uint16) TraceResponse {
+	trace := TraceResponse{Question: dns.Fqdn(name), Type: dns.Type(qtype).String(), Steps: []TraceStep{}}
+	start := time.Now()
+	defer func() {
+		trace.TotalDuration = time.Since(start)
+		trace.TotalDurationString = trace.TotalDuration.String()
+	}()
+	m := new(dns.Msg)
+	m.SetQuestion(trace.Question, qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(4096, true)
+
+	zone, servers := ".", rootHints
+	for len(trace.Steps) < maxTraceSteps {
+		var (
+			step TraceStep
+			resp *dns.Msg
+		)
+		for _, server := range servers {
+			step = TraceStep{Zone: zone, Server: server.Name, Address: server.Address}
+			var err error
+			resp, step.Duration, err = ExchangeContext(ctx, client, m, server.AddressString())
+			step.DurationString = step.Duration.String()
+			if err == nil {
+				break
+			}
+			step.Error = err.Error()
+			trace.Steps = append(trace.Steps, step)
+		}
+		if resp == nil {
+			trace.Status = TraceNoServers
+			return trace
+		}
+		step.msg = resp
+		step.Rcode = dns.RcodeToString[resp.Rcode]
+		for _, rr := range resp.Answer {
+			step.Answer = append(step.Answer, rr.String())
+		}
+
+		referral, nameservers := referralNS(resp, zone)
+		switch {
+		case resp.Rcode == dns.RcodeNameError:
+			trace.Status = TraceNXDomain
+		case len(resp.Answer) > 0:
+			trace.Status = TraceAnswer
+			if qtype != dns.TypeCNAME && !hasType(resp.Answer, qtype) && hasType(resp.Answer, dns.TypeCNAME) {
+				trace.Status = TraceCNAME
+			}
+		case referral == "" && resp.Authoritative:
+			trace.Status = TraceNoData
+		case referral == "":
+			trace.Status = TraceLame
+		}
+		if trace.Status != "" {
+			trace.Steps = append(trace.Steps, step)
+			return trace
+		}
+
+		step.ReferralZone, step.ReferralNS = referral, nameservers
+		for _, rr := range resp.Ns {
+			if ds, ok := rr.(*dns.DS); ok && strings.EqualFold(ds.Hdr.Name, referral) {
+				step.DS = true
+			}
+		}
+		servers = servers[:0:0]
+		for _, ns := range nameservers {
+			glue := glueAddresses(resp.Extra, ns)
+			for _, address := range glue {
+				step.Glue = append(step.Glue, ns+" "+address)
+			}
+			if len(glue) == 0 {
+				glue = resolveHost(ctx, client, resolver, ns, nil)
+			}
+			for _, address := range glue {
+				servers = append(servers, DNSServer{Name: ns, Address: address, Port: authoritativePort})
+			}
+		}
+		trace.Steps = append(trace.Steps, step)
+		zone = referral
+	}
+	trace.Status = TraceTooLong
+	return trace
+}
+
+// referralNS returns the delegated zone and its nameservers if resp is a referral below zone.
+func referralNS(resp *dns.Msg, zone string) (string, []string) {
+	var (
+		referral    string
+		nameservers []string
+	)
+	for _, rr := range resp.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		owner := strings.ToLower(ns.Hdr.Name)
+		if owner == strings.ToLower(zone) || !dns.IsSubDomain(zone, owner) {
+			continue
+		}
+		referral = owner
+		nameservers = append(nameservers, strings.ToLower(ns.Ns))
+	}
+	return referral, nameservers
+}
+
+func glueAddresses(extra []dns.RR, host string) []string {
+	var addresses []string
+	for _, rr := range extra {
+		if a, ok := rr.(*dns.A); ok && strings.EqualFold(a.Hdr.Name, host) {
+			addresses = append(addresses, a.A.String())
+		}
+	}
+	return addresses
+}
+
+func hasType(section []dns.RR, qtype uint16) bool {
+	for _, rr := range section {
+		if rr.Header().Rrtype == qtype {
+			return true
+		}
+	}
+	return false
+}
+
+// TraceTextResponse writes the trace in a dig +trace like layout.
+func TraceTextResponse(w http.ResponseWriter, trace TraceResponse) {
+	w.Header().Set("Content-Type", TextApplicationType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintf(w, "; <<>> world-dns-resolver %s <<>> +trace %s %s\n", versionString, trace.Question, trace.Type)
+	for _, step := range trace.Steps {
+		_, _ = fmt.Fprintln(w)
+		writeTraceStep(w, step)
+	}
+	_, _ = fmt.Fprintf(w, "\n;; Status: %s in %s\n", trace.Status, trace.TotalDurationString)
+}
+
+func writeTraceStep(w io.Writer, step TraceStep) {
+	if step.Error != "" {
+		_, _ = fmt.Fprintf(w, ";; %s(%s) for %s failed: %s\n", step.Address, step.Server, step.Zone, step.Error)
+		return
+	}
+	if step.msg != nil {
+		for _, rr := range step.msg.Answer {
+			_, _ = fmt.Fprintln(w, rr.String())
+		}
+		for _, rr := range step.msg.Ns {
+			switch rr.Header().Rrtype {
+			case dns.TypeNS, dns.TypeDS, dns.TypeSOA:
+				_, _ = fmt.Fprintln(w, rr.String())
+			}
+		}
+	}
+	_, _ = fmt.Fprintf(w, ";; Received from %s#%d(%s) for %s in %d ms\n", step.Address, authoritativePort, step.Server, step.Zone, step.Duration.Milliseconds())
+}
+
+// TraceEndpoint walks the delegation path for the question and returns it as JSON or text.
+func TraceEndpoint(w http.ResponseWriter, r *http.Request) {
+	parsed, err := ParseURLQuery(r.URL)
+	if err != nil {
+		QueryErrorResponse(w, err)
+		return
+	}
+	var resolver DNSServer
+	if len(dnsServers) > 0 {
+		resolver = dnsServers[0]
+	}
+	trace := Trace(r.Context(), NewClient(), resolver, parsed.Domain, parsed.Type)
+	if trace.Status == TraceNoServers {
+		log.Printf("Trace for %s ran out of servers", trace.Question)
+	}
+	if ResponseFormat(r) == "text" {
+		TraceTextResponse(w, trace)
+		return
+	}
+	JSONResponse(w, trace)
+}
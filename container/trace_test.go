@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startTestDNSServerAt runs an in-process UDP DNS server on a fixed address.
+func startTestDNSServerAt(t *testing.T, name, address string, port int, handler dns.HandlerFunc) DNSServer {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		t.Skipf("unable to listen on %s: %v", address, err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return DNSServer{Name: name, Address: address, Port: port}
+}
+
+// referralHandler always answers with a referral built from the given authority and glue records.
+func referralHandler(authority []string, glue []string) dns.HandlerFunc {
+	ns, extra := parseRRs(authority), parseRRs(glue)
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Ns, m.Extra = ns, extra
+		_ = w.WriteMsg(m)
+	}
+}
+
+func parseRRs(records []string) []dns.RR {
+	rrs := make([]dns.RR, 0, len(records))
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			panic(err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+// startTraceHierarchy runs a root, a TLD and an authoritative server on the same
+// port on different loopback addresses and points the root hints at the root.
+func startTraceHierarchy(t *testing.T) {
+	t.Helper()
+	auth := startTestDNSServer(t, "ns1.example.test.", zoneHandler(true,
+		"example.test. 300 IN SOA ns1.example.test. hostmaster.example.test. 1 7200 3600 1209600 300",
+		"www.example.test. 300 IN A 192.0.2.10",
+	))
+	if auth.Address != "127.0.0.1" {
+		t.Skip("loopback address unavailable")
+	}
+	tld := startTestDNSServerAt(t, "ns.nic.test.", "127.0.0.2", auth.Port, referralHandler(
+		[]string{"example.test. 86400 IN NS ns1.example.test."},
+		[]string{"ns1.example.test. 86400 IN A 127.0.0.1"},
+	))
+	root := startTestDNSServerAt(t, "a.root-servers.test.", "127.0.0.3", auth.Port, referralHandler(
+		[]string{
+			"test. 172800 IN NS ns.nic.test.",
+			"test. 86400 IN DS 12345 13 2 " + strings.Repeat("ab", 32),
+		},
+		[]string{"ns.nic.test. 172800 IN A " + tld.Address},
+	))
+
+	origHints, origPort := rootHints, authoritativePort
+	rootHints, authoritativePort = []DNSServer{root}, auth.Port
+	t.Cleanup(func() { rootHints, authoritativePort = origHints, origPort })
+}
+
+func TestTrace(t *testing.T) {
+	startTraceHierarchy(t)
+
+	trace := Trace(context.Background(), NewClient(), DNSServer{}, "www.example.test", dns.TypeA)
+	if trace.Status != TraceAnswer {
+		t.Fatalf("Status = %q, want %q (steps %+v)", trace.Status, TraceAnswer, trace.Steps)
+	}
+	if len(trace.Steps) != 3 {
+		t.Fatalf("got %d steps, want 3", len(trace.Steps))
+	}
+	root, tld, auth := trace.Steps[0], trace.Steps[1], trace.Steps[2]
+	if root.Zone != "." || root.ReferralZone != "test." || !root.DS {
+		t.Errorf("root step = %+v, want a referral to test. with DS", root)
+	}
+	if len(root.Glue) != 1 || root.Glue[0] != "ns.nic.test. 127.0.0.2" {
+		t.Errorf("root glue = %v", root.Glue)
+	}
+	if tld.Zone != "test." || tld.ReferralZone != "example.test." || tld.DS {
+		t.Errorf("tld step = %+v, want an unsigned referral to example.test.", tld)
+	}
+	if auth.Zone != "example.test." || auth.Address != "127.0.0.1" || len(auth.Answer) != 1 {
+		t.Errorf("auth step = %+v, want the answer from 127.0.0.1", auth)
+	}
+}
+
+func TestTrace_NXDomain(t *testing.T) {
+	startTraceHierarchy(t)
+
+	trace := Trace(context.Background(), NewClient(), DNSServer{}, "missing.example.test", dns.TypeA)
+	if trace.Status != TraceNXDomain {
+		t.Errorf("Status = %q, want %q", trace.Status, TraceNXDomain)
+	}
+}
+
+func TestTrace_NoServers(t *testing.T) {
+	dead := startTestDNSServer(t, "dead", func(w dns.ResponseWriter, r *dns.Msg) {})
+	origHints := rootHints
+	rootHints = []DNSServer{dead}
+	t.Cleanup(func() { rootHints = origHints })
+
+	client := NewClient()
+	client.Timeout = 100 * time.Millisecond
+	trace := Trace(context.Background(), client, DNSServer{}, "example.test", dns.TypeA)
+	if trace.Status != TraceNoServers {
+		t.Errorf("Status = %q, want %q", trace.Status, TraceNoServers)
+	}
+	if len(trace.Steps) != 1 || trace.Steps[0].Error == "" {
+		t.Errorf("Steps = %+v, want one failed step", trace.Steps)
+	}
+}
+
+func TestTraceEndpoint(t *testing.T) {
+	startTraceHierarchy(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/trace?domain=www.example.test&type=A", nil)
+	rr := httptest.NewRecorder()
+	TraceEndpoint(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var trace TraceResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &trace); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if trace.Status != TraceAnswer || len(trace.Steps) != 3 {
+		t.Errorf("trace = %+v", trace)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/trace?domain=www.example.test&type=A&format=text", nil)
+	rr = httptest.NewRecorder()
+	TraceEndpoint(rr, req)
+	body := rr.Body.String()
+	for _, want := range []string{"+trace www.example.test. A", "test.\t172800\tIN\tNS\tns.nic.test.", "www.example.test.\t300\tIN\tA\t192.0.2.10", ";; Status: answer"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("text output missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestTraceEndpoint_InvalidQuery(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/trace?domain=example.test", nil)
+	rr := httptest.NewRecorder()
+	TraceEndpoint(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rr.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	TTLRaised       = "raised"
+	TTLClampedFloor = "clamped_floor"
+)
+
+// ttlFloors are minimum TTLs commonly enforced by resolvers.
+var ttlFloors = []int{30, 60, 120, 300, 600, 900, 1800, 3600}
+
+// RecordTTL is a single answer record with its own TTL.
+type RecordTTL struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	TTL   int    `json:"ttl"`
+	Value string `json:"value"`
+	// RdataBase64 is only set for record types without library support, whose value is in \# form.
+	RdataBase64 string `json:"rdata_base64,omitempty"`
+}
+
+// RecordTTLs lists every record with its TTL.
+func RecordTTLs(rrs []dns.RR) []RecordTTL {
+	records := make([]RecordTTL, len(rrs))
+	for i, rr := range rrs {
+		records[i] = RecordTTL{
+			Name:  rr.Header().Name,
+			Type:  dns.Type(rr.Header().Rrtype).String(),
+			TTL:   int(rr.Header().Ttl),
+			Value: RecordValue(rr),
+		}
+		records[i].RdataBase64, _ = GenericRdata(rr)
+	}
+	return records
+}
+
+// FinalTTL returns the lowest TTL of the final RRset, i.e. the records of the queried type.
+// If the answer has no records of that type the lowest TTL of the whole answer is used,
+// and negative answers use the SOA minimum from the authority section as described in RFC 2308.
+func FinalTTL(msg *dns.Msg, qtype uint16) int {
+	if len(msg.Answer) == 0 {
+		return NegativeTTL(msg)
+	}
+	lowest, found := -1, false
+	for _, rr := range msg.Answer {
+		if rr.Header().Rrtype != qtype && qtype != dns.TypeANY {
+			continue
+		}
+		if ttl := int(rr.Header().Ttl); !found || ttl < lowest {
+			lowest, found = ttl, true
+		}
+	}
+	if found {
+		return lowest
+	}
+	for _, rr := range msg.Answer {
+		if ttl := int(rr.Header().Ttl); lowest < 0 || ttl < lowest {
+			lowest = ttl
+		}
+	}
+	return lowest
+}
+
+// NegativeTTL returns the negative caching TTL of a response, the lower of the SOA TTL and its minimum field.
+func NegativeTTL(msg *dns.Msg) int {
+	for _, rr := range msg.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return int(min(soa.Hdr.Ttl, soa.Minttl))
+		}
+	}
+	return 0
+}
+
+// DetectTTLAnomaly compares the resolver's records against the authoritative answer and reports
+// records whose TTL exceeds the original TTL. A TTL is only reported as clamped when it equals a
+// common floor and the original TTL is below that floor, any other increase is reported as raised.
+func DetectTTLAnomaly(msg, authoritative *dns.Msg) (string, string) {
+	original := make(map[string]uint32, len(authoritative.Answer))
+	for _, rr := range authoritative.Answer {
+		original[ttlKey(rr)] = rr.Header().Ttl
+	}
+	for _, rr := range msg.Answer {
+		authTTL, ok := original[ttlKey(rr)]
+		ttl := rr.Header().Ttl
+		if !ok || ttl <= authTTL {
+			continue
+		}
+		record := fmt.Sprintf("%s %s", rr.Header().Name, dns.Type(rr.Header().Rrtype).String())
+		if floor := int(ttl); slices.Contains(ttlFloors, floor) && int(authTTL) < floor {
+			return TTLClampedFloor, fmt.Sprintf("%s authoritative TTL %d was clamped to the floor %d", record, authTTL, floor)
+		}
+		return TTLRaised, fmt.Sprintf("%s TTL %d exceeds authoritative TTL %d", record, ttl, authTTL)
+	}
+	return "", ""
+}
+
+func ttlKey(rr dns.RR) string {
+	return strings.ToLower(rr.Header().Name) + "/" + dns.Type(rr.Header().Rrtype).String()
+}
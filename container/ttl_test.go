@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestFinalTTL(t *testing.T) {
+	msg := &dns.Msg{Answer: []dns.RR{
+		mustRR(t, "www.example.com. 3600 IN CNAME example.com."),
+		mustRR(t, "example.com. 300 IN A 192.0.2.1"),
+		mustRR(t, "example.com. 120 IN A 192.0.2.2"),
+	}}
+	if ttl := FinalTTL(msg, dns.TypeA); ttl != 120 {
+		t.Errorf("FinalTTL(A) = %d, want 120", ttl)
+	}
+	if ttl := FinalTTL(msg, dns.TypeCNAME); ttl != 3600 {
+		t.Errorf("FinalTTL(CNAME) = %d, want 3600", ttl)
+	}
+	if ttl := FinalTTL(msg, dns.TypeAAAA); ttl != 120 {
+		t.Errorf("FinalTTL(AAAA) = %d, want 120", ttl)
+	}
+
+	negative := &dns.Msg{Ns: []dns.RR{mustRR(t, "example.com. 3600 IN SOA ns.example.com. admin.example.com. 1 7200 3600 1209600 900")}}
+	if ttl := FinalTTL(negative, dns.TypeA); ttl != 900 {
+		t.Errorf("FinalTTL(negative) = %d, want 900", ttl)
+	}
+}
+
+func TestDetectTTLAnomaly(t *testing.T) {
+	auth := &dns.Msg{Answer: []dns.RR{mustRR(t, "example.com. 20 IN A 192.0.2.1")}}
+	tests := []struct {
+		record string
+		want   string
+	}{
+		{"example.com. 15 IN A 192.0.2.1", ""},
+		{"Example.com. 30 IN A 192.0.2.1", TTLClampedFloor},
+		{"example.com. 86400 IN A 192.0.2.1", TTLRaised},
+		{"example.com. 25 IN A 192.0.2.1", TTLRaised},
+		{"other.example.com. 86400 IN A 192.0.2.1", ""},
+	}
+	for _, tt := range tests {
+		got, reason := DetectTTLAnomaly(&dns.Msg{Answer: []dns.RR{mustRR(t, tt.record)}}, auth)
+		if got != tt.want {
+			t.Errorf("DetectTTLAnomaly(%q) = %q (%s), want %q", tt.record, got, reason, tt.want)
+		}
+	}
+}
+
+func TestResolve_TTLCheck(t *testing.T) {
+	auth := startTestDNSServer(t, "ns1.example.com.", zoneHandler(true,
+		"example.com. 20 IN A 192.0.2.1",
+	))
+	resolver := startTestDNSServer(t, "Resolver", zoneHandler(false,
+		"example.com. 3600 IN SOA ns1.example.com. admin.example.com. 1 7200 3600 1209600 900",
+		"example.com. 3600 IN NS ns1.example.com.",
+		"ns1.example.com. 3600 IN A 127.0.0.1",
+		"example.com. 300 IN A 192.0.2.1",
+	))
+	useDNSServers(t, resolver)
+	origPort := authoritativePort
+	authoritativePort = auth.Port
+	t.Cleanup(func() { authoritativePort = origPort })
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=example.com&type=A&ttl_check=true", nil)
+	w := httptest.NewRecorder()
+	ResolveEndpoint(w, req)
+	var response LookupResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&response); err != nil {
+		t.Fatalf("unable to decode response: %v", err)
+	}
+	if response.AuthoritativeTTL == nil || *response.AuthoritativeTTL != 20 {
+		t.Fatalf("expected authoritative TTL 20, got %v", response.AuthoritativeTTL)
+	}
+	answer := response.Answers[0]
+	if answer.TTLAnomaly != TTLClampedFloor || answer.TTL != 300 || len(answer.Records) != 1 {
+		t.Errorf("unexpected answer %+v", answer)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -23,24 +27,153 @@ func JSONResponse(w http.ResponseWriter, body any) {
 
 type ParsedQuestion struct {
 	Domain string
-	Type   uint16
+	// IDN is set when the domain was given as a U-label or A-label, Domain is then the A-label form.
+	IDN  *IDNInfo
+	Type uint16
+	// Types lists every requested type, Type is the first of them.
+	Types       []uint16
+	Sort        string
+	TTLCheck    bool
+	HijackCheck bool
+	DNSSEC      bool
+	Chase       bool
+	// Samples is the number of times every server is queried, SampleInterval the wait between rounds.
+	Samples        int
+	SampleInterval time.Duration
+	// Deadline bounds the upstream queries, servers that have not answered by then are reported as incomplete.
+	Deadline time.Duration
+	// Expected holds the canonical rdata of the values the answer should contain.
+	Expected []string
+	// ECS is the client subnet sent with the query, invalid when none was requested.
+	ECS netip.Prefix
+	// IP is the address a reverse lookup was built from, FCrDNS asks for the PTR names to be resolved back.
+	IP     netip.Addr
+	FCrDNS bool
+	// Cookies asks for a DNS cookie to be sent to every server.
+	Cookies bool
+	// TLS sends the question over DNS over TLS, only to the servers that support it.
+	TLS bool
+	// RD, DO, CD and AD are the header and EDNS flags set on the query.
+	RD bool
+	DO bool
+	CD bool
+	AD bool
 }
 
 func ParseURLQuery(url *url.URL) (*ParsedQuestion, error) {
+	var err error
 	parsed := &ParsedQuestion{}
 	query := url.Query()
-	if domain := query.Get("domain"); domain != "" {
-		parsed.Domain = domain
+	if ip := query.Get("ip"); ip != "" {
+		if parsed.IP, parsed.Domain, err = ReverseName(ip); err != nil {
+			return nil, &QuestionError{Code: ErrInvalidIP, Message: err.Error()}
+		}
+		if query.Get("type") == "" {
+			query.Set("type", "PTR")
+		}
+	} else if domain := query.Get("domain"); domain != "" {
+		if parsed.Domain, parsed.IDN, err = NormalizeDomain(domain); err != nil {
+			return nil, &QuestionError{Code: ErrInvalidIDN, Message: err.Error()}
+		}
 	} else {
-		return nil, fmt.Errorf("missing 'domain' parameter in query")
+		return nil, questionErrorf(ErrMissingDomain, "missing 'domain' parameter in query")
 	}
 	if typeStr := query.Get("type"); typeStr != "" {
-		parsed.Type = dns.StringToType[typeStr]
-		if parsed.Type == 0 {
-			return nil, fmt.Errorf("invalid DNS type: %s", typeStr)
+		if parsed.Types, err = ParseTypes(typeStr); err != nil {
+			return nil, err
+		}
+		parsed.Type = parsed.Types[0]
+		for _, qtype := range parsed.Types {
+			if err := ValidateDomain(parsed.Domain, qtype); err != nil {
+				return nil, err
+			}
 		}
 	} else {
-		return nil, fmt.Errorf("missing 'type' parameter in query")
+		return nil, questionErrorf(ErrMissingType, "missing 'type' parameter in query")
+	}
+	parsed.Sort = query.Get("sort")
+	if _, ok := answerSorters[parsed.Sort]; parsed.Sort != "" && !ok {
+		return nil, fmt.Errorf("invalid sort: %s", parsed.Sort)
+	}
+	parsed.TTLCheck = QueryBool(query, "ttl_check")
+	parsed.HijackCheck = QueryBool(query, "hijack_check")
+	parsed.DNSSEC = QueryBool(query, "dnssec")
+	parsed.Chase = QueryBool(query, "chase")
+	parsed.FCrDNS = QueryBool(query, "fcrdns")
+	parsed.Cookies = QueryBool(query, "cookies")
+	switch transport := query.Get("transport"); transport {
+	case "", "udp":
+	case "tls":
+		parsed.TLS = true
+	default:
+		return nil, fmt.Errorf("invalid transport: %s", transport)
+	}
+	parsed.RD = query.Get("rd") == "" || QueryBool(query, "rd")
+	parsed.DO = QueryBool(query, "do")
+	parsed.CD = QueryBool(query, "cd")
+	parsed.AD = QueryBool(query, "adflag")
+	if parsed.Samples, err = QueryInt(query, "samples", 1, 1, maxSamples); err != nil {
+		return nil, err
+	}
+	interval, err := QueryInt(query, "sample_interval_ms", 0, 0, 5000)
+	if err != nil {
+		return nil, err
+	}
+	parsed.SampleInterval = time.Duration(interval) * time.Millisecond
+	deadline, err := QueryInt(query, "deadline_ms", 0, 100, 30000)
+	if err != nil {
+		return nil, err
+	}
+	parsed.Deadline = time.Duration(deadline) * time.Millisecond
+	if expect := query["expect"]; len(expect) > 0 {
+		if len(parsed.Types) > 1 {
+			return nil, fmt.Errorf("expect is only supported with a single type")
+		}
+		expected, err := ParseExpected(parsed.Domain, parsed.Type, expect)
+		if err != nil {
+			return nil, err
+		}
+		parsed.Expected = expected
+	}
+	if ecs := query.Get("ecs"); ecs != "" {
+		if parsed.ECS, err = ParseECS(ecs); err != nil {
+			return nil, err
+		}
 	}
 	return parsed, nil
 }
+
+// RecordValue returns the rdata of a record in presentation format.
+func RecordValue(rr dns.RR) string {
+	if a, ok := rr.(*dns.CNAME); ok {
+		return a.Target
+	}
+	stringAnswer := rr.String()
+	parts := strings.Split(stringAnswer, "\t")
+	if len(parts) > 0 {
+		return parts[len(parts)-1]
+	}
+	return stringAnswer // Use the full string as a fallback
+}
+
+// QueryBool reports whether the query parameter key is set to a true value.
+func QueryBool(query url.Values, key string) bool {
+	switch strings.ToLower(query.Get(key)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// QueryInt parses the query parameter key as an integer between lower and upper, returning def when it is not set.
+func QueryInt(query url.Values, key string, def, lower, upper int) (int, error) {
+	raw := query.Get(key)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < lower || n > upper {
+		return 0, fmt.Errorf("invalid %s: must be a number between %d and %d", key, lower, upper)
+	}
+	return n, nil
+}
@@ -100,3 +100,39 @@ func TestJSONResponse_Success(t *testing.T) {
 //		t.Errorf("expected error message in response body, got %q", buf.String())
 //	}
 //}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("invalid URL %q: %v", raw, err)
+	}
+	return u
+}
+
+func TestParseURLQuery_Flags(t *testing.T) {
+	parsed, err := ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com&type=A"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !parsed.RD || parsed.DO || parsed.CD || parsed.AD {
+		t.Errorf("default flags = rd %v do %v cd %v ad %v, want only rd", parsed.RD, parsed.DO, parsed.CD, parsed.AD)
+	}
+
+	parsed, err = ParseURLQuery(mustParseURL(t, "/lookup?domain=example.com&type=A&rd=0&do=1&cd=true&adflag=yes"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if parsed.RD || !parsed.DO || !parsed.CD || !parsed.AD {
+		t.Errorf("flags = rd %v do %v cd %v ad %v, want rd off and the rest on", parsed.RD, parsed.DO, parsed.CD, parsed.AD)
+	}
+
+	m := NewQuestionMsg(parsed)
+	if m.RecursionDesired || !m.CheckingDisabled || !m.AuthenticatedData || m.IsEdns0() == nil || !m.IsEdns0().Do() {
+		t.Errorf("query header = %s, want cd ad and DO without rd", headerFlags(m))
+	}
+	response := NewLookupResponse(parsed)
+	if response.Flags != (QueryFlags{DO: true, CD: true, AD: true}) {
+		t.Errorf("echoed flags = %+v", response.Flags)
+	}
+}
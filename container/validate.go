@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Error codes returned in the code field of a rejected request.
+const (
+	ErrMissingDomain    = "missing_domain"
+	ErrMissingType      = "missing_type"
+	ErrMissingIP        = "missing_ip"
+	ErrInvalidType      = "invalid_type"
+	ErrMetaType         = "meta_type"
+	ErrDomainTooLong    = "domain_too_long"
+	ErrLabelTooLong     = "label_too_long"
+	ErrEmptyLabel       = "empty_label"
+	ErrInvalidCharacter = "invalid_character"
+	ErrInvalidHyphen    = "invalid_hyphen"
+	ErrUnderscoreLabel  = "underscore_not_allowed"
+	ErrInvalidIDN       = "invalid_idn"
+	ErrInvalidIP        = "invalid_ip"
+	ErrInvalidParameter = "invalid_parameter"
+	ErrMethodNotAllowed = "method_not_allowed"
+	ErrInvalidBatch     = "invalid_batch"
+	ErrBatchTooLarge    = "batch_too_large"
+	ErrNoServers        = "no_servers"
+	ErrUpstream         = "upstream_error"
+	ErrUnknownServer    = "unknown_server"
+)
+
+const (
+	invalidQueryResponse = "Invalid query parameters: "
+	maxDomainLength      = 253
+	maxLabelLength       = 63
+)
+
+// metaTypes can not be asked of a recursive resolver.
+var metaTypes = map[uint16]bool{
+	dns.TypeOPT:   true,
+	dns.TypeTSIG:  true,
+	dns.TypeTKEY:  true,
+	dns.TypeIXFR:  true,
+	dns.TypeAXFR:  true,
+	dns.TypeMAILA: true,
+	dns.TypeMAILB: true,
+}
+
+// underscoreTypes are the types whose owner names commonly have underscore labels, e.g. _sip._tcp or _dmarc.
+var underscoreTypes = map[uint16]bool{
+	dns.TypeSRV:   true,
+	dns.TypeTXT:   true,
+	dns.TypeTLSA:  true,
+	dns.TypeURI:   true,
+	dns.TypeSVCB:  true,
+	dns.TypeHTTPS: true,
+	dns.TypeCNAME: true,
+	dns.TypePTR:   true,
+	dns.TypeANY:   true,
+}
+
+// QuestionError is a rejected question with a machine-readable code.
+type QuestionError struct {
+	Code    string
+	Message string
+}
+
+func (e *QuestionError) Error() string {
+	return e.Message
+}
+
+func questionErrorf(code, format string, args ...any) error {
+	return &QuestionError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorResponse is the JSON body of a rejected request.
+type ErrorResponse struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// ErrorCode returns the code of a QuestionError, or ErrInvalidParameter for any other error.
+func ErrorCode(err error) string {
+	var questionErr *QuestionError
+	if errors.As(err, &questionErr) {
+		return questionErr.Code
+	}
+	return ErrInvalidParameter
+}
+
+// ErrorJSONResponse writes a JSON error body with the status and code.
+func ErrorJSONResponse(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", JSONApplicationType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Code: code, Error: message}); err != nil {
+		log.Printf("Error encoding JSON error response: %v", err)
+	}
+}
+
+// QueryErrorResponse writes err as a 400 JSON error, using the code of a QuestionError when there is one.
+func QueryErrorResponse(w http.ResponseWriter, err error) {
+	ErrorJSONResponse(w, http.StatusBadRequest, ErrorCode(err), invalidQueryResponse+err.Error())
+}
+
+// ParseType parses a type name case-insensitively, or in the RFC 3597 TYPE123 form.
+func ParseType(name string) (uint16, error) {
+	upper := strings.ToUpper(strings.TrimSpace(name))
+	if qtype, ok := dns.StringToType[upper]; ok {
+		return qtype, nil
+	}
+	if number, ok := strings.CutPrefix(upper, "TYPE"); ok {
+		if n, err := strconv.ParseUint(number, 10, 16); err == nil && n > 0 {
+			return uint16(n), nil
+		}
+	}
+	return 0, questionErrorf(ErrInvalidType, "invalid DNS type: %s", name)
+}
+
+// ValidateType rejects meta types that are not answered by recursive resolvers.
+func ValidateType(qtype uint16) error {
+	if metaTypes[qtype] {
+		return questionErrorf(ErrMetaType, "unsupported type for recursive lookups: %s", dns.Type(qtype).String())
+	}
+	return nil
+}
+
+// ValidateDomain checks the length, labels and characters of an ASCII domain name.
+// Underscore labels are only accepted for the types that use them.
+func ValidateDomain(domain string, qtype uint16) error {
+	name := strings.TrimSuffix(domain, ".")
+	if name == "" {
+		if domain == "." {
+			return nil
+		}
+		return questionErrorf(ErrEmptyLabel, "empty domain name")
+	}
+	if len(name) > maxDomainLength {
+		return questionErrorf(ErrDomainTooLong, "domain name is %d characters long, the limit is %d", len(name), maxDomainLength)
+	}
+	for i, label := range strings.Split(name, ".") {
+		switch {
+		case label == "":
+			return questionErrorf(ErrEmptyLabel, "domain name %s has an empty label", domain)
+		case len(label) > maxLabelLength:
+			return questionErrorf(ErrLabelTooLong, "label %s is %d characters long, the limit is %d", label, len(label), maxLabelLength)
+		case label == "*" && i == 0:
+			continue
+		case strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-"):
+			return questionErrorf(ErrInvalidHyphen, "label %s starts or ends with a hyphen", label)
+		}
+		for _, r := range label {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			case r == '_':
+				if !underscoreTypes[qtype] {
+					return questionErrorf(ErrUnderscoreLabel, "label %s has an underscore, which is only allowed for service lookups such as SRV and TXT", label)
+				}
+			default:
+				return questionErrorf(ErrInvalidCharacter, "label %s has an invalid character %q", label, r)
+			}
+		}
+	}
+	return nil
+}
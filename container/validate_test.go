@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		qtype  uint16
+		code   string
+	}{
+		{"example.com.", dns.TypeA, ""},
+		{"Example-1.COM", dns.TypeA, ""},
+		{".", dns.TypeNS, ""},
+		{"*.example.com.", dns.TypeA, ""},
+		{"_dmarc.example.com.", dns.TypeTXT, ""},
+		{"_sip._tcp.example.com.", dns.TypeSRV, ""},
+		{"not_a_domain.", dns.TypeA, ErrUnderscoreLabel},
+		{"a..example.com.", dns.TypeA, ErrEmptyLabel},
+		{"-bad.example.com.", dns.TypeA, ErrInvalidHyphen},
+		{"bad-.example.com.", dns.TypeA, ErrInvalidHyphen},
+		{"sp ace.example.com.", dns.TypeA, ErrInvalidCharacter},
+		{"www.*.example.com.", dns.TypeA, ErrInvalidCharacter},
+		{strings.Repeat("a", 64) + ".com.", dns.TypeA, ErrLabelTooLong},
+		{strings.Repeat(strings.Repeat("a", 60)+".", 5), dns.TypeA, ErrDomainTooLong},
+	}
+	for _, tt := range tests {
+		err := ValidateDomain(tt.domain, tt.qtype)
+		code := ""
+		if qerr, ok := err.(*QuestionError); ok {
+			code = qerr.Code
+		} else if err != nil {
+			t.Errorf("ValidateDomain(%q) returned %T, want a *QuestionError", tt.domain, err)
+		}
+		if code != tt.code {
+			t.Errorf("ValidateDomain(%q, %s) code = %q (%v), want %q", tt.domain, dns.TypeToString[tt.qtype], code, err, tt.code)
+		}
+	}
+}
+
+func TestParseType(t *testing.T) {
+	tests := map[string]uint16{
+		"A":        dns.TypeA,
+		"aaaa":     dns.TypeAAAA,
+		" Mx ":     dns.TypeMX,
+		"TYPE65":   dns.TypeHTTPS,
+		"type1234": 1234,
+	}
+	for name, want := range tests {
+		got, err := ParseType(name)
+		if err != nil || got != want {
+			t.Errorf("ParseType(%q) = %d, %v, want %d", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"TYPE0", "TYPE65536", "TYPEX", "NOPE"} {
+		if _, err := ParseType(name); err == nil || err.(*QuestionError).Code != ErrInvalidType {
+			t.Errorf("ParseType(%q) error = %v, want invalid_type", name, err)
+		}
+	}
+}
+
+func TestValidateType(t *testing.T) {
+	for _, qtype := range []uint16{dns.TypeOPT, dns.TypeTSIG, dns.TypeIXFR, dns.TypeAXFR} {
+		if err := ValidateType(qtype); err == nil || err.(*QuestionError).Code != ErrMetaType {
+			t.Errorf("ValidateType(%s) error = %v, want meta_type", dns.TypeToString[qtype], err)
+		}
+	}
+	if err := ValidateType(dns.TypeANY); err != nil {
+		t.Errorf("ValidateType(ANY) error = %v", err)
+	}
+}
+
+func TestResolveEndpoint_ErrorCodes(t *testing.T) {
+	tests := map[string]string{
+		"/lookup?type=A":                           ErrMissingDomain,
+		"/lookup?domain=example.com":               ErrMissingType,
+		"/lookup?domain=not_a_domain&type=A":       ErrUnderscoreLabel,
+		"/lookup?domain=example.com&type=axfr":     ErrMetaType,
+		"/lookup?domain=example.com&type=BOGUS":    ErrInvalidType,
+		"/lookup?domain=xn--zz.com&type=A":         ErrInvalidIDN,
+		"/lookup?ip=300.0.0.1":                     ErrInvalidIP,
+		"/lookup?domain=example.com&type=A&sort=x": ErrInvalidParameter,
+	}
+	for target, code := range tests {
+		rr := httptest.NewRecorder()
+		ResolveEndpoint(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s status = %d, want 400", target, rr.Code)
+			continue
+		}
+		var body ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s returned invalid JSON: %v", target, err)
+			continue
+		}
+		if body.Code != code || !strings.HasPrefix(body.Error, "Invalid query parameters: ") {
+			t.Errorf("%s error = %+v, want code %q", target, body, code)
+		}
+	}
+}
+
+func TestEndpoints_NoServers(t *testing.T) {
+	useDNSServers(t)
+	endpoints := map[string]http.HandlerFunc{
+		"/propagation?domain=example.com&type=A": PropagationEndpoint,
+		"/delegation?domain=example.com&type=A":  DelegationEndpoint,
+		"/zone-report?domain=example.com&type=A": ZoneReportEndpoint,
+	}
+	for target, endpoint := range endpoints {
+		rr := httptest.NewRecorder()
+		endpoint(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		var body ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s returned invalid JSON: %v", target, err)
+			continue
+		}
+		if rr.Code != http.StatusInternalServerError || body.Code != ErrNoServers {
+			t.Errorf("%s status = %d, code = %q, want 500 %q", target, rr.Code, body.Code, ErrNoServers)
+		}
+	}
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// zoneReportTimeout caps a zone report when the request has no deadline_ms.
+const zoneReportTimeout = 30 * time.Second
+
+// openRecursionProbe is a name outside of any zone under test, used to see if a server recurses for anyone.
+var openRecursionProbe = "www.iana.org."
+
+// ZoneCheck is the result of a single zone health check.
+type ZoneCheck struct {
+	Name        string   `json:"name"`
+	Result      string   `json:"result"`
+	Explanation string   `json:"explanation"`
+	Details     []string `json:"details,omitempty"`
+}
+
+// ZoneReport is the outcome of every health check for a zone.
+type ZoneReport struct {
+	Zone           string        `json:"zone"`
+	Nameservers    []string      `json:"nameservers"`
+	Checks         []ZoneCheck   `json:"checks"`
+	Pass           int           `json:"pass"`
+	Warn           int           `json:"warn"`
+	Fail           int           `json:"fail"`
+	Incomplete     bool          `json:"incomplete,omitempty"`
+	Duration       time.Duration `json:"duration"`
+	DurationString string        `json:"duration_string"`
+}
+
+// BuildZoneReport runs the delegation and configuration checks against the authoritative servers of the zone containing domain.
+// The checks run concurrently, when ctx expires the servers that have not answered are reported and the report is marked incomplete.
+func BuildZoneReport(ctx context.Context, client *dns.Client, resolver DNSServer, domain string) (*ZoneReport, error) {
+	start := time.Now()
+	delegation, err := CheckDelegation(ctx, client, resolver, domain, dns.TypeSOA)
+	if err != nil {
+		return nil, err
+	}
+	report := &ZoneReport{Zone: delegation.Zone, Nameservers: []string{}}
+	var servers []DNSServer
+	for _, ns := range delegation.Nameservers {
+		if ns.Address == "" {
+			continue
+		}
+		server := DNSServer{Name: ns.Name, Address: ns.Address, Port: authoritativePort}
+		report.Nameservers = append(report.Nameservers, server.String())
+		if !ns.Lame && !ns.Unreachable && !ns.Incomplete {
+			servers = append(servers, server)
+		}
+	}
+
+	checks := []func() ZoneCheck{
+		func() ZoneCheck { return checkNSCount(delegation) },
+		func() ZoneCheck { return checkNSDiversity(delegation) },
+		func() ZoneCheck { return checkDelegationHealth(delegation) },
+		func() ZoneCheck { return checkSOATimers(ctx, client, servers, delegation.Zone) },
+		func() ZoneCheck { return checkTCP(ctx, client, servers, delegation.Zone) },
+		func() ZoneCheck { return checkEDNS(ctx, client, servers, delegation.Zone) },
+		func() ZoneCheck { return checkOpenRecursion(ctx, client, servers) },
+		func() ZoneCheck { return checkAXFR(ctx, client, servers, delegation.Zone) },
+		func() ZoneCheck { return checkDNSSEC(ctx, client, resolver, delegation.Zone) },
+		func() ZoneCheck { return checkDSMatch(ctx, client, resolver, servers, delegation.Zone) },
+	}
+	report.Checks = make([]ZoneCheck, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check func() ZoneCheck) {
+			defer wg.Done()
+			report.Checks[i] = check()
+		}(i, check)
+	}
+	wg.Wait()
+	report.Incomplete = len(delegation.Incomplete) > 0 || contextExpired(ctx)
+	for _, check := range report.Checks {
+		switch check.Result {
+		case CheckPass:
+			report.Pass++
+		case CheckWarn:
+			report.Warn++
+		default:
+			report.Fail++
+		}
+	}
+	report.Duration = time.Since(start)
+	report.DurationString = report.Duration.String()
+	return report, nil
+}
+
+// delegatedNS returns the union of the parent and child NS sets.
+func delegatedNS(delegation *DelegationReport) []string {
+	names := slices.Concat(delegation.ParentNS, delegation.ChildNS)
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+func checkNSCount(delegation *DelegationReport) ZoneCheck {
+	check := ZoneCheck{Name: "ns_count", Details: delegatedNS(delegation)}
+	if n := len(check.Details); n < 2 {
+		check.Result, check.Explanation = CheckFail, fmt.Sprintf("%d nameserver, at least 2 are required (RFC 1034)", n)
+	} else {
+		check.Result, check.Explanation = CheckPass, fmt.Sprintf("%d nameservers", n)
+	}
+	return check
+}
+
+// checkNSDiversity counts the distinct /24 and /48 prefixes, and ASNs when an IP database is loaded.
+func checkNSDiversity(delegation *DelegationReport) ZoneCheck {
+	check := ZoneCheck{Name: "ns_diversity"}
+	prefixes, asns := map[string]bool{}, map[uint]bool{}
+	for _, ns := range delegation.Nameservers {
+		addr, err := netip.ParseAddr(ns.Address)
+		if err != nil {
+			continue
+		}
+		bits := 48
+		if addr.Is4() {
+			bits = 24
+		}
+		prefix, _ := addr.Prefix(bits)
+		prefixes[prefix.String()] = true
+		if geoDB != nil {
+			if info, ok := geoDB.Lookup(ns.Address); ok && info.ASN != 0 {
+				asns[info.ASN] = true
+				check.Details = append(check.Details, fmt.Sprintf("%s AS%d", ns.Address, info.ASN))
+			}
+		}
+	}
+	explanation := fmt.Sprintf("%d distinct network prefixes", len(prefixes))
+	if geoDB != nil {
+		explanation += fmt.Sprintf(", %d distinct ASNs", len(asns))
+	}
+	check.Explanation = explanation
+	switch {
+	case len(prefixes) < 2 || (geoDB != nil && len(asns) < 2):
+		check.Result = CheckWarn
+		check.Explanation += ", a single network outage can take every nameserver down (RFC 2182)"
+	default:
+		check.Result = CheckPass
+	}
+	return check
+}
+
+func checkDelegationHealth(delegation *DelegationReport) ZoneCheck {
+	check := ZoneCheck{Name: "delegation", Result: CheckPass, Explanation: "parent and child agree and every nameserver answers authoritatively"}
+	var problems []string
+	for _, lame := range delegation.Lame {
+		check.Details = append(check.Details, "lame: "+lame)
+	}
+	for _, ns := range delegation.MissingGlue {
+		check.Details = append(check.Details, "missing glue: "+ns)
+	}
+	if len(delegation.Lame) > 0 || len(delegation.MissingGlue) > 0 {
+		check.Result = CheckFail
+		problems = append(problems, "lame delegations or missing glue")
+	}
+	for _, ns := range delegation.OnlyInParent {
+		check.Details = append(check.Details, "only in parent: "+ns)
+	}
+	for _, ns := range delegation.OnlyInChild {
+		check.Details = append(check.Details, "only in child: "+ns)
+	}
+	for _, ns := range delegation.OutOfSync {
+		check.Details = append(check.Details, "out of sync: "+ns)
+	}
+	for _, ns := range delegation.Unreachable {
+		check.Details = append(check.Details, "unreachable: "+ns)
+	}
+	for _, ns := range delegation.Incomplete {
+		check.Details = append(check.Details, "no answer before the deadline: "+ns)
+	}
+	if !delegation.NSMatch || len(delegation.OutOfSync) > 0 {
+		if check.Result == CheckPass {
+			check.Result = CheckWarn
+		}
+		problems = append(problems, "NS set mismatch or out of sync servers")
+	}
+	if len(delegation.Unreachable) > 0 {
+		if check.Result == CheckPass {
+			check.Result = CheckWarn
+		}
+		problems = append(problems, "unreachable nameservers")
+	}
+	if len(problems) > 0 {
+		check.Explanation = strings.Join(problems, ", ")
+	}
+	return check
+}
+
+// checkSOATimers compares the SOA timers against the ranges recommended by RFC 1912 and RFC 2308.
+func checkSOATimers(ctx context.Context, client *dns.Client, servers []DNSServer, zone string) ZoneCheck {
+	check := ZoneCheck{Name: "soa_timers"}
+	resp, _, err := QueryAuthoritative(ctx, client, servers, zone, dns.TypeSOA)
+	if err != nil {
+		check.Result, check.Explanation = CheckFail, fmt.Sprintf("unable to fetch SOA: %v", err)
+		return check
+	}
+	var soa *dns.SOA
+	for _, rr := range resp.Answer {
+		if s, ok := rr.(*dns.SOA); ok {
+			soa = s
+		}
+	}
+	if soa == nil {
+		check.Result, check.Explanation = CheckFail, "no SOA record in the authoritative answer"
+		return check
+	}
+	check.Result, check.Explanation = CheckPass, fmt.Sprintf("refresh %d, retry %d, expire %d, minimum %d", soa.Refresh, soa.Retry, soa.Expire, soa.Minttl)
+	if soa.Refresh < 1200 || soa.Refresh > 43200 {
+		check.Details = append(check.Details, "refresh should be between 1200 and 43200 seconds")
+	}
+	if soa.Retry < 120 || soa.Retry >= soa.Refresh {
+		check.Details = append(check.Details, "retry should be at least 120 seconds and less than refresh")
+	}
+	if soa.Expire < 1209600 || soa.Expire > 2419200 {
+		check.Details = append(check.Details, "expire should be between 1209600 and 2419200 seconds")
+	}
+	if soa.Minttl < 300 || soa.Minttl > 86400 {
+		check.Details = append(check.Details, "minimum should be between 300 and 86400 seconds")
+	}
+	if len(check.Details) > 0 {
+		check.Result = CheckWarn
+	}
+	return check
+}
+
+// eachServer runs probe against every server concurrently, collecting the failures it reports in server order.
+// Servers whose probe ends after ctx expired are returned as incomplete instead of failed.
+func eachServer(ctx context.Context, servers []DNSServer, probe func(DNSServer) string) ([]string, []string) {
+	problems := make([]string, len(servers))
+	expired := make([]bool, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server DNSServer) {
+			defer wg.Done()
+			problems[i] = probe(server)
+			expired[i] = contextExpired(ctx)
+		}(i, server)
+	}
+	wg.Wait()
+	var failures, incomplete []string
+	for i, server := range servers {
+		switch {
+		case expired[i]:
+			incomplete = append(incomplete, server.String())
+		case problems[i] != "":
+			failures = append(failures, fmt.Sprintf("%s: %s", server.String(), problems[i]))
+		}
+	}
+	return failures, incomplete
+}
+
+// addIncomplete lists the servers that did not answer before the deadline, a passing check becomes a warning.
+func addIncomplete(check *ZoneCheck, incomplete []string) {
+	if len(incomplete) == 0 {
+		return
+	}
+	for _, server := range incomplete {
+		check.Details = append(check.Details, server+": no answer before the deadline")
+	}
+	if check.Result == CheckPass {
+		check.Result, check.Explanation = CheckWarn, "not every nameserver answered before the deadline"
+	}
+}
+
+func checkTCP(ctx context.Context, client *dns.Client, servers []DNSServer, zone string) ZoneCheck {
+	check := ZoneCheck{Name: "tcp"}
+	tcp := &dns.Client{Net: "tcp", Timeout: client.Timeout}
+	failures, incomplete := eachServer(ctx, servers, func(server DNSServer) string {
+		m := new(dns.Msg)
+		m.SetQuestion(zone, dns.TypeSOA)
+		m.RecursionDesired = false
+		if _, _, err := ExchangeContext(ctx, tcp, m, server.AddressString()); err != nil {
+			return err.Error()
+		}
+		return ""
+	})
+	check.Details = failures
+	if len(check.Details) > 0 {
+		check.Result, check.Explanation = CheckFail, "not every nameserver answers over TCP, which is required (RFC 7766)"
+	} else {
+		check.Result, check.Explanation = CheckPass, "every nameserver answers over TCP"
+	}
+	addIncomplete(&check, incomplete)
+	return check
+}
+
+// checkEDNS sends a plain EDNS0 query and an EDNS version 1 query, which must be answered with BADVERS (RFC 6891).
+func checkEDNS(ctx context.Context, client *dns.Client, servers []DNSServer, zone string) ZoneCheck {
+	check := ZoneCheck{Name: "edns", Result: CheckPass, Explanation: "every nameserver supports EDNS0 and rejects unknown versions"}
+	var noEDNS atomic.Bool
+	failures, incomplete := eachServer(ctx, servers, func(server DNSServer) string {
+		m := new(dns.Msg)
+		m.SetQuestion(zone, dns.TypeSOA)
+		m.RecursionDesired = false
+		m.SetEdns0(1232, false)
+		resp, _, err := ExchangeContext(ctx, client, m, server.AddressString())
+		if err != nil || resp.IsEdns0() == nil {
+			noEDNS.Store(true)
+			return "no OPT record in the response"
+		}
+		m.IsEdns0().SetVersion(1)
+		resp, _, err = ExchangeContext(ctx, client, m, server.AddressString())
+		if err != nil || resp.Rcode != dns.RcodeBadVers || resp.IsEdns0() == nil {
+			return "EDNS version 1 not answered with BADVERS"
+		}
+		return ""
+	})
+	check.Details = failures
+	switch {
+	case noEDNS.Load() && len(failures) > 0:
+		check.Result, check.Explanation = CheckFail, "some nameservers do not support EDNS0"
+	case len(failures) > 0:
+		check.Result, check.Explanation = CheckWarn, "some nameservers do not handle unknown EDNS versions"
+	}
+	addIncomplete(&check, incomplete)
+	return check
+}
+
+func checkOpenRecursion(ctx context.Context, client *dns.Client, servers []DNSServer) ZoneCheck {
+	check := ZoneCheck{Name: "open_recursion"}
+	failures, incomplete := eachServer(ctx, servers, func(server DNSServer) string {
+		m := new(dns.Msg)
+		m.SetQuestion(openRecursionProbe, dns.TypeA)
+		m.RecursionDesired = true
+		resp, _, err := ExchangeContext(ctx, client, m, server.AddressString())
+		if err != nil || !resp.RecursionAvailable || resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+			return ""
+		}
+		return "answered a recursive query for " + openRecursionProbe
+	})
+	check.Details = failures
+	if len(check.Details) > 0 {
+		check.Result, check.Explanation = CheckFail, "some nameservers are open recursive resolvers"
+	} else {
+		check.Result, check.Explanation = CheckPass, "no nameserver recursed for an outside name"
+	}
+	addIncomplete(&check, incomplete)
+	return check
+}
+
+func checkAXFR(ctx context.Context, client *dns.Client, servers []DNSServer, zone string) ZoneCheck {
+	check := ZoneCheck{Name: "axfr"}
+	tcp := &dns.Client{Net: "tcp", Timeout: client.Timeout}
+	failures, incomplete := eachServer(ctx, servers, func(server DNSServer) string {
+		conn, err := tcp.DialContext(ctx, server.AddressString())
+		if err != nil {
+			return ""
+		}
+		defer conn.Close()
+		// The transfer sets its own read deadlines, closing the connection is what stops it.
+		stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+		defer stop()
+		transfer := &dns.Transfer{Conn: conn, DialTimeout: client.Timeout, ReadTimeout: client.Timeout}
+		m := new(dns.Msg)
+		m.SetAxfr(zone)
+		envelopes, err := transfer.In(m, server.AddressString())
+		if err != nil {
+			return ""
+		}
+		records := 0
+		for envelope := range envelopes {
+			if envelope.Error == nil {
+				records += len(envelope.RR)
+			}
+		}
+		if records == 0 {
+			return ""
+		}
+		return fmt.Sprintf("zone transfer returned %d records", records)
+	})
+	check.Details = failures
+	if len(check.Details) > 0 {
+		check.Result, check.Explanation = CheckFail, "some nameservers allow anyone to transfer the zone"
+	} else {
+		check.Result, check.Explanation = CheckPass, "zone transfers are refused"
+	}
+	addIncomplete(&check, incomplete)
+	return check
+}
+
+func checkDNSSEC(ctx context.Context, client *dns.Client, resolver DNSServer, zone string) ZoneCheck {
+	check := ZoneCheck{Name: "dnssec"}
+	validator, err := NewValidator(client, resolver)
+	if err != nil {
+		check.Result, check.Explanation = CheckFail, err.Error()
+		return check
+	}
+	chain := validator.Chain(ctx, zone)
+	check.Explanation = "chain of trust is " + chain.Status
+	if chain.Reason != "" {
+		check.Details = append(check.Details, chain.Reason)
+	}
+	if chain.Link != "" {
+		check.Details = append(check.Details, "failing link: "+chain.Link)
+	}
+	switch chain.Status {
+	case DNSSECSecure:
+		check.Result = CheckPass
+	case DNSSECBogus:
+		check.Result = CheckFail
+	default:
+		check.Result = CheckWarn
+	}
+	return check
+}
+
+// checkDSMatch compares the DS records in the parent with the DNSKEY records served by the zone.
+func checkDSMatch(ctx context.Context, client *dns.Client, resolver DNSServer, servers []DNSServer, zone string) ZoneCheck {
+	check := ZoneCheck{Name: "ds_dnskey"}
+	m := new(dns.Msg)
+	m.SetQuestion(zone, dns.TypeDS)
+	m.RecursionDesired = true
+	m.SetEdns0(4096, true)
+	dsResp, _, err := ExchangeContext(ctx, client, m, resolver.AddressString())
+	if err != nil {
+		check.Result, check.Explanation = CheckWarn, fmt.Sprintf("unable to fetch DS records: %v", err)
+		return check
+	}
+	var ds []*dns.DS
+	for _, rr := range dsResp.Answer {
+		if d, ok := rr.(*dns.DS); ok {
+			ds = append(ds, d)
+		}
+	}
+	var keys []*dns.DNSKEY
+	if keyResp, _, err := QueryAuthoritative(ctx, client, servers, zone, dns.TypeDNSKEY); err == nil {
+		for _, rr := range keyResp.Answer {
+			if k, ok := rr.(*dns.DNSKEY); ok {
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	switch {
+	case len(ds) == 0 && len(keys) == 0:
+		check.Result, check.Explanation = CheckWarn, "zone is not signed"
+		return check
+	case len(ds) == 0:
+		check.Result, check.Explanation = CheckWarn, "DNSKEY records are published but the parent has no DS records"
+		return check
+	case len(keys) == 0:
+		check.Result, check.Explanation = CheckFail, "the parent has DS records but the zone serves no DNSKEY records"
+		return check
+	}
+	matched := 0
+	for _, d := range ds {
+		match := false
+		for _, k := range keys {
+			if d.KeyTag != k.KeyTag() || d.Algorithm != k.Algorithm {
+				continue
+			}
+			if digest := k.ToDS(d.DigestType); digest != nil && strings.EqualFold(digest.Digest, d.Digest) {
+				match = true
+			}
+		}
+		if match {
+			matched++
+		} else {
+			check.Details = append(check.Details, fmt.Sprintf("DS %d has no matching DNSKEY", d.KeyTag))
+		}
+	}
+	switch matched {
+	case len(ds):
+		check.Result, check.Explanation = CheckPass, "every DS record matches a DNSKEY"
+	case 0:
+		check.Result, check.Explanation = CheckFail, "no DS record matches a DNSKEY"
+	default:
+		check.Result, check.Explanation = CheckWarn, "some DS records do not match a DNSKEY"
+	}
+	return check
+}
+
+// ZoneReportEndpoint runs every zone health check for the domain query parameter.
+func ZoneReportEndpoint(w http.ResponseWriter, r *http.Request) {
+	domain := r.URL.Query().Get("domain")
+	if domain == "" {
+		QueryErrorResponse(w, questionErrorf(ErrMissingDomain, "missing 'domain' parameter in query"))
+		return
+	}
+	domain, _, err := NormalizeDomain(domain)
+	if err == nil {
+		err = ValidateDomain(domain, dns.TypeSOA)
+	}
+	if err != nil {
+		QueryErrorResponse(w, err)
+		return
+	}
+	if len(dnsServers) == 0 {
+		ErrorJSONResponse(w, http.StatusInternalServerError, ErrNoServers, "No DNS servers configured")
+		return
+	}
+	deadline, err := QueryInt(r.URL.Query(), "deadline_ms", int(zoneReportTimeout/time.Millisecond), 100, 120000)
+	if err != nil {
+		QueryErrorResponse(w, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(deadline)*time.Millisecond)
+	defer cancel()
+	report, err := BuildZoneReport(ctx, NewClient(), dnsServers[0], dns.Fqdn(domain))
+	if err != nil {
+		log.Printf("Error building zone report for %s: %v", domain, err)
+		ErrorJSONResponse(w, http.StatusBadGateway, ErrUpstream, fmt.Sprintf("Unable to build zone report: %v", err))
+		return
+	}
+	JSONResponse(w, report)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startTestTCPServerAt runs an in-process TCP DNS server on a fixed address.
+func startTestTCPServerAt(t *testing.T, address string, port int, handler dns.HandlerFunc) {
+	t.Helper()
+	l, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		t.Skipf("unable to listen on %s: %v", address, err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{Listener: l, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+}
+
+// reportZoneHandler serves example.test with EDNS support. An open server also recurses
+// for outside names and allows zone transfers.
+func reportZoneHandler(open bool) dns.HandlerFunc {
+	zone := zoneHandler(true,
+		"example.test. 300 IN SOA ns1.example.test. hostmaster.example.test. 1 7200 3600 1209600 300",
+		"example.test. 300 IN NS ns1.example.test.",
+		"example.test. 300 IN NS ns2.example.test.",
+	)
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		q := r.Question[0]
+		opt := r.IsEdns0()
+		switch {
+		case opt != nil:
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Authoritative = true
+			m.SetEdns0(1232, false)
+			if opt.Version() != 0 {
+				m.Rcode = dns.RcodeBadVers
+			}
+			_ = w.WriteMsg(m)
+		case open && q.Qtype == dns.TypeAXFR:
+			soa, _ := dns.NewRR("example.test. 300 IN SOA ns1.example.test. hostmaster.example.test. 1 7200 3600 1209600 300")
+			a, _ := dns.NewRR("www.example.test. 300 IN A 192.0.2.1")
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Answer = []dns.RR{soa, a, soa}
+			_ = w.WriteMsg(m)
+		case open && r.RecursionDesired && !dns.IsSubDomain("example.test.", q.Name):
+			rr, _ := dns.NewRR(q.Name + " 300 IN A 192.0.2.200")
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.RecursionAvailable = true
+			m.Answer = []dns.RR{rr}
+			_ = w.WriteMsg(m)
+		case q.Qtype == dns.TypeAXFR:
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeRefused)
+			_ = w.WriteMsg(m)
+		default:
+			zone(w, r)
+		}
+	}
+}
+
+// startReportHierarchy delegates example.test to ns1 and ns2, where ns2 is open and only ns1 answers over TCP.
+func startReportHierarchy(t *testing.T) DNSServer {
+	t.Helper()
+	resolver := startTestDNSServer(t, "resolver", zoneHandler(false,
+		"example.test. 300 IN SOA ns1.example.test. hostmaster.example.test. 1 7200 3600 1209600 300",
+		"test. 300 IN SOA ns.nic.test. hostmaster.nic.test. 1 7200 3600 1209600 300",
+		"test. 300 IN NS ns.nic.test.",
+		"ns.nic.test. 300 IN A 127.0.0.2",
+		"ns1.example.test. 300 IN A 127.0.0.3",
+		"ns2.example.test. 300 IN A 127.0.0.4",
+	))
+	if resolver.Address != "127.0.0.1" {
+		t.Skip("loopback address unavailable")
+	}
+	startTestDNSServerAt(t, "ns.nic.test.", "127.0.0.2", resolver.Port, referralHandler(
+		[]string{
+			"example.test. 86400 IN NS ns1.example.test.",
+			"example.test. 86400 IN NS ns2.example.test.",
+		},
+		[]string{
+			"ns1.example.test. 86400 IN A 127.0.0.3",
+			"ns2.example.test. 86400 IN A 127.0.0.4",
+		},
+	))
+	startTestDNSServerAt(t, "ns1.example.test.", "127.0.0.3", resolver.Port, reportZoneHandler(false))
+	startTestTCPServerAt(t, "127.0.0.3", resolver.Port, reportZoneHandler(false))
+	startTestDNSServerAt(t, "ns2.example.test.", "127.0.0.4", resolver.Port, reportZoneHandler(true))
+
+	origPort := authoritativePort
+	authoritativePort = resolver.Port
+	t.Cleanup(func() { authoritativePort = origPort })
+	return resolver
+}
+
+func TestBuildZoneReport(t *testing.T) {
+	resolver := startReportHierarchy(t)
+	client := NewClient()
+	client.Timeout = 500 * time.Millisecond
+
+	report, err := BuildZoneReport(context.Background(), client, resolver, "example.test.")
+	if err != nil {
+		t.Fatalf("BuildZoneReport() error = %v", err)
+	}
+	if report.Zone != "example.test." || len(report.Nameservers) != 2 {
+		t.Fatalf("zone = %q, nameservers = %v", report.Zone, report.Nameservers)
+	}
+	want := map[string]string{
+		"ns_count":       CheckPass,
+		"ns_diversity":   CheckWarn,
+		"delegation":     CheckPass,
+		"soa_timers":     CheckPass,
+		"tcp":            CheckFail,
+		"edns":           CheckPass,
+		"open_recursion": CheckFail,
+		"ds_dnskey":      CheckWarn,
+	}
+	results := map[string]ZoneCheck{}
+	for _, check := range report.Checks {
+		results[check.Name] = check
+	}
+	for name, result := range want {
+		if results[name].Result != result {
+			t.Errorf("%s = %+v, want %s", name, results[name], result)
+		}
+	}
+	if _, ok := results["dnssec"]; !ok {
+		t.Error("dnssec check missing")
+	}
+	if report.Pass+report.Warn+report.Fail != len(report.Checks) {
+		t.Errorf("counts %d/%d/%d do not add up to %d checks", report.Pass, report.Warn, report.Fail, len(report.Checks))
+	}
+}
+
+func TestCheckAXFR(t *testing.T) {
+	open := startTestDNSServer(t, "open", reportZoneHandler(true))
+	if open.Address != "127.0.0.1" {
+		t.Skip("loopback address unavailable")
+	}
+	closed := startTestDNSServerAt(t, "closed", "127.0.0.2", open.Port, reportZoneHandler(false))
+	startTestTCPServerAt(t, "127.0.0.1", open.Port, reportZoneHandler(true))
+	startTestTCPServerAt(t, "127.0.0.2", open.Port, reportZoneHandler(false))
+
+	check := checkAXFR(context.Background(), NewClient(), []DNSServer{open, closed}, "example.test.")
+	if check.Result != CheckFail || len(check.Details) != 1 {
+		t.Errorf("checkAXFR() = %+v, want a single failure for the open server", check)
+	}
+}
+
+func TestCheckTCP_Deadline(t *testing.T) {
+	fast := startTestDNSServer(t, "fast", reportZoneHandler(false))
+	if fast.Address != "127.0.0.1" {
+		t.Skip("loopback address unavailable")
+	}
+	slow := startTestDNSServerAt(t, "slow", "127.0.0.2", fast.Port, reportZoneHandler(false))
+	startTestTCPServerAt(t, "127.0.0.1", fast.Port, reportZoneHandler(false))
+	startTestTCPServerAt(t, "127.0.0.2", fast.Port, slowHandler(time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	check := checkTCP(ctx, NewClient(), []DNSServer{fast, slow}, "example.test.")
+	if elapsed := time.Since(start); elapsed > 700*time.Millisecond {
+		t.Errorf("checkTCP() took %v, want it to stop at the deadline", elapsed)
+	}
+	if check.Result != CheckWarn || len(check.Details) != 1 || check.Details[0] != slow.String()+": no answer before the deadline" {
+		t.Errorf("checkTCP() = %+v, want a warning for the slow server only", check)
+	}
+}
+
+func TestCheckSOATimers(t *testing.T) {
+	server := startTestDNSServer(t, "ns", zoneHandler(true,
+		"example.test. 300 IN SOA ns1.example.test. hostmaster.example.test. 1 600 900 86400 5",
+	))
+	check := checkSOATimers(context.Background(), NewClient(), []DNSServer{server}, "example.test.")
+	if check.Result != CheckWarn || len(check.Details) != 4 {
+		t.Errorf("checkSOATimers() = %+v, want a warning for every timer", check)
+	}
+}
+
+func TestCheckNSCount(t *testing.T) {
+	check := checkNSCount(&DelegationReport{ParentNS: []string{"ns1.example.test."}, ChildNS: []string{"ns1.example.test."}})
+	if check.Result != CheckFail {
+		t.Errorf("checkNSCount() = %+v, want fail for a single nameserver", check)
+	}
+}
+
+func TestZoneReportEndpoint(t *testing.T) {
+	resolver := startReportHierarchy(t)
+	useDNSServers(t, resolver)
+
+	req := httptest.NewRequest(http.MethodGet, "/zone_report?domain=example.test", nil)
+	rr := httptest.NewRecorder()
+	ZoneReportEndpoint(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var report ZoneReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if report.Zone != "example.test." || len(report.Checks) != 10 {
+		t.Errorf("report = %+v", report)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/zone_report", nil)
+	rr = httptest.NewRecorder()
+	ZoneReportEndpoint(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status without domain = %d, want 400", rr.Code)
+	}
+}
+
+func TestCheckDelegationHealth_Unreachable(t *testing.T) {
+	check := checkDelegationHealth(&DelegationReport{NSMatch: true, Unreachable: []string{"ns2.example.test. (127.0.0.4)"}})
+	if check.Result != CheckWarn || !slices.Equal(check.Details, []string{"unreachable: ns2.example.test. (127.0.0.4)"}) {
+		t.Errorf("checkDelegationHealth() = %+v, want a warning for an unreachable server", check)
+	}
+}
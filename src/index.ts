@@ -68,9 +68,19 @@ class LookupEndpoint extends OpenAPIRoute {
 	schema = {
 		request: {
 			query: z.object({
-				domain: z.string().describe("The domain to look up"),
-				type: z.string().describe("The DNS record type to look up, e.g., A, AAAA, CNAME, etc."),
+				domain: z.string().optional().describe("The domain to look up, required unless ip is set"),
+				type: z
+					.string()
+					.optional()
+					.describe("The DNS record type to look up, e.g., A, AAAA, CNAME, etc. Required unless ip is set"),
+				ip: z.string().optional().describe("An IPv4 or IPv6 address to look up the PTR records of"),
+				fcrdns: z.string().optional().describe("If set to 'true' with ip, confirm the PTR names resolve back to ip"),
 				no_cache: z.string().optional().describe("If set to 'true', the response will not be cached"),
+				format: z.string().optional().describe("The output format: json (default), text, zone, csv or ndjson"),
+				stream: z
+					.string()
+					.optional()
+					.describe("Stream the answers as they arrive: sse, true or 1 for Server-Sent Events, ndjson for NDJSON"),
 			}),
 		},
 		responses: {
@@ -101,7 +111,7 @@ class LookupEndpoint extends OpenAPIRoute {
 				),
 			},
 			"400": {
-				description: "Bad Request - Missing domain or type query parameters",
+				description: "Bad Request - Missing domain and type, or ip query parameters",
 				...contentJson(
 					z.object({
 						error: z.string().describe("Error message indicating missing parameters"),
@@ -117,7 +127,12 @@ class LookupEndpoint extends OpenAPIRoute {
 			return c.json({ error: "Missing query parameters" }, 400);
 		}
 		``;
-		const { domain, type, no_cache } = queryParams;
+		const { domain, type, ip, no_cache } = queryParams;
+		if (isStreamRequest(c.req.raw)) {
+			// Streamed answers are forwarded as they arrive and never cached
+			const container = await getRandom(c.env.RESOLVER, 3);
+			return container.fetch(c.req.raw);
+		}
 		const cache = caches.default;
 		let response = await cache.match(c.req.raw);
 		if (response && !no_cache) {
@@ -131,11 +146,19 @@ class LookupEndpoint extends OpenAPIRoute {
 			});
 		}
 		try {
-			if (!domain || !type) {
-				return c.json({ error: "Missing domain or type query parameters" }, 400);
+			if (!ip && (!domain || !type)) {
+				return c.json({ error: "Missing domain and type, or ip query parameters" }, 400);
 			}
 			const container = await getRandom(c.env.RESOLVER, 3);
 			const containerResponse = await container.fetch(c.req.raw);
+			if (!containerResponse.ok) {
+				// Keep the container's status and error code, errors are never cached
+				return containerResponse;
+			}
+			if (!containerResponse.headers.get("Content-Type")?.startsWith("application/json")) {
+				// Text, zone, CSV and NDJSON output is passed through as rendered, keeping its Content-Disposition
+				return containerResponse;
+			}
 			const resp: LookupResponse = await containerResponse.json();
 			const shortestTTL = getShortestTTL(resp);
 			const isNoCache = no_cache === "true";
@@ -305,6 +328,412 @@ class DNSTypesEndpoint extends OpenAPIRoute {
 
 openapi.get("/dns_types", DNSTypesEndpoint);
 
+// errorSchema is the JSON error body the container returns for rejected questions and upstream failures.
+const errorSchema = z.object({
+	code: z.string().describe("Machine-readable error code, e.g. invalid_domain"),
+	error: z.string().describe("Error message"),
+});
+
+class PropagationEndpoint extends OpenAPIRoute {
+	schema = {
+		request: {
+			query: z.object({
+				domain: z.string().describe("The domain to check"),
+				type: z.string().describe("The DNS record type to check, e.g., A, AAAA, CNAME, etc."),
+			}),
+		},
+		responses: {
+			"200": {
+				description: "Every resolver compared against the authoritative answer",
+				...contentJson(
+					z.object({
+						question: z.string().describe("The domain being queried"),
+						type: z.string().describe("The DNS record type queried"),
+						answers: z
+							.array(
+								z.object({
+									server: z.string().describe("The DNS server that provided the answer"),
+									values: z.array(z.string()).describe("The resolved values for the domain"),
+									ttl: z.number().describe("Time to live for the DNS record in seconds"),
+									propagation: z.string().describe("propagated, stale or missing"),
+									propagation_eta_seconds: z
+										.number()
+										.optional()
+										.describe("Seconds until a stale answer expires from the resolver's cache"),
+								}),
+							)
+							.describe("List of answers from different DNS servers"),
+						propagation: z.object({
+							source: z.string().describe("Where the expected values came from"),
+							authoritative_server: z.string().optional().describe("The authoritative server that was asked"),
+							expected: z.array(z.string()).describe("The expected values"),
+							propagated: z.number().describe("Number of resolvers returning the expected values"),
+							stale: z.number().describe("Number of resolvers returning other values"),
+							missing: z.number().describe("Number of resolvers returning no values"),
+							percent_propagated: z.number().describe("Percentage of resolvers that are propagated"),
+							estimated_complete_seconds: z.number().describe("Seconds until every stale answer expires"),
+							estimated_complete_at: z.string().describe("RFC 3339 time every stale answer expires"),
+						}),
+					}),
+				),
+			},
+			"400": {
+				description: "Bad Request - Invalid domain or type",
+				...contentJson(errorSchema),
+			},
+			"502": {
+				description: "The authoritative servers could not be queried",
+				...contentJson(errorSchema),
+			},
+		},
+	};
+	async handle(c: AppContext) {
+		const container = await getRandom(c.env.RESOLVER, 3);
+		return container.fetch(c.req.raw);
+	}
+}
+
+openapi.get("/propagation", PropagationEndpoint);
+
+class TraceEndpoint extends OpenAPIRoute {
+	schema = {
+		request: {
+			query: z.object({
+				domain: z.string().describe("The domain to trace"),
+				type: z.string().describe("The DNS record type to trace, e.g., A, AAAA, CNAME, etc."),
+				format: z.string().optional().describe("The output format: json (default) or text"),
+			}),
+		},
+		responses: {
+			"200": {
+				description: "The delegation path from the root to the authoritative answer",
+				...contentJson(
+					z.object({
+						question: z.string().describe("The domain being traced"),
+						type: z.string().describe("The DNS record type traced"),
+						status: z.string().describe("How the trace ended"),
+						steps: z
+							.array(
+								z.object({
+									zone: z.string().describe("The zone the server was asked for"),
+									server: z.string().describe("The nameserver queried"),
+									server_address: z.string().describe("The address of the nameserver"),
+									rcode: z.string().optional().describe("The response code"),
+									referral_zone: z.string().optional().describe("The zone the server referred to"),
+									referral_ns: z.array(z.string()).optional().describe("The nameservers of the referral"),
+									glue: z.array(z.string()).optional().describe("The glue records of the referral"),
+									ds: z.boolean().describe("Whether the referral carried DS records"),
+									answer: z.array(z.string()).optional().describe("The final answer"),
+									error: z.string().optional().describe("Why the server could not be queried"),
+									duration: z.number().describe("Duration of the query in nanoseconds"),
+									duration_string: z.string().describe("Duration of the query as a string"),
+								}),
+							)
+							.describe("Every server queried on the way down"),
+						total_duration: z.number().describe("Total duration of the trace in nanoseconds"),
+						total_duration_string: z.string().describe("Total duration of the trace as a string"),
+					}),
+				),
+			},
+			"400": {
+				description: "Bad Request - Invalid domain or type",
+				...contentJson(errorSchema),
+			},
+		},
+	};
+	async handle(c: AppContext) {
+		const container = await getRandom(c.env.RESOLVER, 3);
+		return container.fetch(c.req.raw);
+	}
+}
+
+openapi.get("/trace", TraceEndpoint);
+
+class DelegationEndpoint extends OpenAPIRoute {
+	schema = {
+		request: {
+			query: z.object({
+				domain: z.string().describe("The domain to check"),
+				type: z.string().describe("The DNS record type to compare, e.g., A, AAAA, CNAME, etc."),
+				deadline_ms: z.string().optional().describe("Deadline for the whole check in milliseconds, 15000 by default"),
+			}),
+		},
+		responses: {
+			"200": {
+				description: "The delegation compared between the parent, the child and every authoritative server",
+				...contentJson(
+					z.object({
+						question: z.string().describe("The domain being checked"),
+						type: z.string().describe("The DNS record type compared"),
+						zone: z.string().describe("The zone containing the domain"),
+						parent_zone: z.string().describe("The parent zone"),
+						parent_server: z.string().describe("The parent server that was asked for the delegation"),
+						parent_ns: z.array(z.string()).describe("The NS set in the parent"),
+						child_ns: z.array(z.string()).describe("The NS set in the child"),
+						ns_match: z.boolean().describe("Whether the parent and child NS sets match"),
+						only_in_parent: z.array(z.string()).optional().describe("Nameservers only listed in the parent"),
+						only_in_child: z.array(z.string()).optional().describe("Nameservers only listed in the child"),
+						missing_glue: z.array(z.string()).optional().describe("In-zone nameservers without glue"),
+						serial: z.number().describe("The highest SOA serial"),
+						serials_in_sync: z.boolean().describe("Whether every server has the same serial"),
+						rrset_in_sync: z.boolean().describe("Whether every server returns the same RRset"),
+						lame: z.array(z.string()).optional().describe("Servers that are not authoritative for the zone"),
+						unreachable: z.array(z.string()).optional().describe("Servers that could not be reached"),
+						out_of_sync: z.array(z.string()).optional().describe("Servers with an old serial or another RRset"),
+						incomplete: z.array(z.string()).optional().describe("Servers that did not answer before the deadline"),
+						nameservers: z
+							.array(
+								z.object({
+									name: z.string().describe("The nameserver host"),
+									address: z.string().describe("The address that was queried"),
+									authoritative: z.boolean().describe("Whether the answer was authoritative"),
+									lame: z.boolean().describe("Whether the server is lame"),
+									unreachable: z.boolean().optional().describe("Whether the server could not be reached"),
+									serial: z.number().optional().describe("The SOA serial"),
+									values: z.array(z.string()).describe("The RRset returned"),
+									in_sync: z.boolean().describe("Whether the server agrees with the majority"),
+									error: z.string().optional().describe("Why the check failed"),
+								}),
+							)
+							.describe("One check per nameserver address"),
+						duration: z.number().describe("Duration of the check in nanoseconds"),
+						duration_string: z.string().describe("Duration of the check as a string"),
+					}),
+				),
+			},
+			"400": {
+				description: "Bad Request - Invalid domain or type",
+				...contentJson(errorSchema),
+			},
+			"502": {
+				description: "The delegation could not be found",
+				...contentJson(errorSchema),
+			},
+		},
+	};
+	async handle(c: AppContext) {
+		const container = await getRandom(c.env.RESOLVER, 3);
+		return container.fetch(c.req.raw);
+	}
+}
+
+openapi.get("/delegation", DelegationEndpoint);
+
+class ZoneReportEndpoint extends OpenAPIRoute {
+	schema = {
+		request: {
+			query: z.object({
+				domain: z.string().describe("The zone to report on"),
+				deadline_ms: z.string().optional().describe("Deadline for the whole report in milliseconds, 30000 by default"),
+			}),
+		},
+		responses: {
+			"200": {
+				description: "The result of every zone health check",
+				...contentJson(
+					z.object({
+						zone: z.string().describe("The zone checked"),
+						nameservers: z.array(z.string()).describe("The authoritative servers of the zone"),
+						checks: z
+							.array(
+								z.object({
+									name: z.string().describe("The check, e.g. ns_count, soa_timers or ds_dnskey"),
+									result: z.string().describe("pass, warn or fail"),
+									explanation: z.string().describe("Why the check has this result"),
+									details: z.array(z.string()).optional().describe("The servers or records involved"),
+								}),
+							)
+							.describe("One result per check"),
+						pass: z.number().describe("Number of passing checks"),
+						warn: z.number().describe("Number of checks with a warning"),
+						fail: z.number().describe("Number of failing checks"),
+						incomplete: z.boolean().optional().describe("Whether the deadline expired before every check finished"),
+						duration: z.number().describe("Duration of the report in nanoseconds"),
+						duration_string: z.string().describe("Duration of the report as a string"),
+					}),
+				),
+			},
+			"400": {
+				description: "Bad Request - Missing or invalid domain",
+				...contentJson(errorSchema),
+			},
+			"502": {
+				description: "The delegation of the zone could not be found",
+				...contentJson(errorSchema),
+			},
+		},
+	};
+	async handle(c: AppContext) {
+		const container = await getRandom(c.env.RESOLVER, 3);
+		return container.fetch(c.req.raw);
+	}
+}
+
+openapi.get("/zone_report", ZoneReportEndpoint);
+
+class ECSSweepEndpoint extends OpenAPIRoute {
+	schema = {
+		request: {
+			query: z.object({
+				domain: z.string().describe("The domain to look up"),
+				type: z.string().describe("A single DNS record type to look up, e.g., A or AAAA"),
+				server: z.string().optional().describe("Name or address of the resolver to sweep, the first one by default"),
+				subnets: z.string().optional().describe("Comma-separated client subnets replacing the default list"),
+			}),
+		},
+		responses: {
+			"200": {
+				description: "The answers of one resolver for every client subnet",
+				...contentJson(
+					z.object({
+						question: z.string().describe("The domain being queried"),
+						type: z.string().describe("The DNS record type queried"),
+						server: z.string().describe("The resolver that was swept"),
+						results: z
+							.array(
+								z.object({
+									country: z.string().optional().describe("The country the subnet stands for"),
+									subnet: z.string().describe("The client subnet sent"),
+									scope: z.number().optional().describe("The scope prefix length the resolver returned"),
+									rcode: z.string().optional().describe("The response code"),
+									values: z.array(z.string()).describe("The resolved values"),
+									error: z.string().optional().describe("Why the query failed"),
+								}),
+							)
+							.describe("One result per client subnet"),
+						destinations: z
+							.record(z.array(z.string()))
+							.describe("The subnets, keyed by the comma-separated answer they received"),
+					}),
+				),
+			},
+			"400": {
+				description: "Bad Request - Invalid question, subnet or unknown server",
+				...contentJson(errorSchema),
+			},
+		},
+	};
+	async handle(c: AppContext) {
+		const container = await getRandom(c.env.RESOLVER, 3);
+		return container.fetch(c.req.raw);
+	}
+}
+
+openapi.get("/ecs_sweep", ECSSweepEndpoint);
+
+class BatchEndpoint extends OpenAPIRoute {
+	schema = {
+		request: {
+			query: z.object({
+				deadline_ms: z
+					.string()
+					.optional()
+					.describe("Deadline for the whole batch in milliseconds, 30000 by default"),
+				format: z.string().optional().describe("The output format: json (default), csv or ndjson"),
+			}),
+			body: contentJson(
+				z
+					.array(
+						z.object({
+							domain: z.string().describe("The domain to look up"),
+							type: z.string().describe("The DNS record type to look up, e.g., A, AAAA, CNAME, etc."),
+							options: z
+								.record(z.string())
+								.optional()
+								.describe("Lookup query parameters for this question, e.g. {\"rd\": \"false\"}"),
+						}),
+					)
+					.describe("The questions to look up"),
+			),
+		},
+		responses: {
+			"200": {
+				description: "The results keyed by domain/TYPE, with the questions still pending at the deadline",
+				...contentJson(
+					z.object({
+						results: z.record(z.any()).describe("The lookup response of every finished question"),
+						errors: z.record(errorSchema).optional().describe("The questions that were rejected"),
+						pending: z.array(z.string()).optional().describe("The questions still running at the deadline"),
+						complete: z.boolean().describe("Whether every question finished"),
+						total_duration: z.number().describe("Total duration of the batch in nanoseconds"),
+						total_duration_string: z.string().describe("Total duration of the batch as a string"),
+					}),
+				),
+			},
+			"400": {
+				description: "Bad Request - Invalid or empty batch, or too many questions",
+				...contentJson(errorSchema),
+			},
+			"413": {
+				description: "The batch body is too large",
+				...contentJson(errorSchema),
+			},
+		},
+	};
+	async handle(c: AppContext) {
+		// The body and the response are passed through as is, the container validates the batch
+		const container = await getRandom(c.env.RESOLVER, 3);
+		return container.fetch(c.req.raw);
+	}
+}
+
+openapi.post("/batch", BatchEndpoint);
+
+class ReverseEndpoint extends OpenAPIRoute {
+	schema = {
+		request: {
+			query: z.object({
+				ip: z.string().describe("The IPv4 or IPv6 address to look up the PTR records of"),
+				fcrdns: z.string().optional().describe("If set to 'true', confirm the PTR names resolve back to ip"),
+			}),
+		},
+		responses: {
+			"200": {
+				description: "Successful reverse DNS lookup",
+				...contentJson(
+					z.object({
+						question: z.string().describe("The in-addr.arpa or ip6.arpa name queried"),
+						type: z.string().describe("The DNS record type queried"),
+						answers: z
+							.array(
+								z.object({
+									server: z.string().describe("The DNS server that provided the answer"),
+									values: z.array(z.string()).describe("The PTR names"),
+									server_address: z.string().describe("The address of the DNS server"),
+									ttl: z.number().describe("Time to live for the DNS record in seconds"),
+									fcrdns: z
+										.object({
+											confirmed: z.boolean().describe("Whether a PTR name resolves back to ip"),
+											confirmed_names: z.array(z.string()).describe("The PTR names that resolve back to ip"),
+											unconfirmed_names: z
+												.array(z.string())
+												.optional()
+												.describe("The PTR names that do not resolve back to ip"),
+										})
+										.optional()
+										.describe("The forward-confirmed reverse DNS check, with fcrdns=true"),
+								}),
+							)
+							.describe("List of answers from different DNS servers"),
+						total_duration: z.number().describe("Total duration of the DNS query in nanoseconds"),
+						total_duration_string: z.string().describe("Total duration of the DNS query as a string"),
+					}),
+				),
+			},
+			"400": {
+				description: "Bad Request - Missing or invalid ip",
+				...contentJson(errorSchema),
+			},
+		},
+	};
+	async handle(c: AppContext) {
+		const container = await getRandom(c.env.RESOLVER, 3);
+		return container.fetch(c.req.raw);
+	}
+}
+
+openapi.get("/reverse", ReverseEndpoint);
+
 export function getShortestTTL(response: LookupResponse): number | null {
 	if (!response.answers || response.answers.length === 0) {
 		return null;
@@ -320,4 +749,13 @@ export function getShortestTTL(response: LookupResponse): number | null {
 	return minTTL;
 }
 
+// isStreamRequest mirrors the container's StreamFormat: the stream query parameter or an Accept header asking for SSE.
+export function isStreamRequest(request: Request): boolean {
+	const stream = new URL(request.url).searchParams.get("stream")?.toLowerCase() ?? "";
+	if (["sse", "true", "1", "ndjson"].includes(stream)) {
+		return true;
+	}
+	return request.headers.get("Accept")?.includes("text/event-stream") ?? false;
+}
+
 export default app;
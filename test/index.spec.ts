@@ -22,3 +22,62 @@ describe("Hello World worker", () => {
 		expect(await response.text()).toMatchInlineSnapshot(`"Hello World!"`);
 	});
 });
+
+// fakeResolver stands in for the container binding, every instance answers with handler.
+function fakeResolver(handler: (request: Request) => Response | Promise<Response>) {
+	return {
+		idFromName: (name: string) => name,
+		get: () => ({ fetch: (request: Request) => handler(request) }),
+	} as unknown as Env["RESOLVER"];
+}
+
+describe("lookup exports", () => {
+	it("passes CSV through unchanged", async () => {
+		const csv =
+			"server,server_address,container_location,question,type,rcode,value,ttl,duration_ms,server_location\r\n" +
+			"Cloudflare,1.1.1.1,LHR,example.com.,A,NOERROR,192.0.2.1,300,12.5,\r\n";
+		const disposition = 'attachment; filename="lookup-example.com-A.csv"';
+		let forwarded: URL | undefined;
+		const testEnv = {
+			...env,
+			RESOLVER: fakeResolver((request) => {
+				forwarded = new URL(request.url);
+				return new Response(csv, {
+					headers: { "Content-Type": "text/csv; charset=utf-8", "Content-Disposition": disposition },
+				});
+			}),
+		};
+		const request = new IncomingRequest(
+			"http://example.com/api/v1/lookup?domain=example.com&type=A&format=csv&no_cache=true",
+		);
+		const ctx = createExecutionContext();
+		const response = await worker.fetch(request, testEnv, ctx);
+		await waitOnExecutionContext(ctx);
+		expect(forwarded?.searchParams.get("format")).toBe("csv");
+		expect(response.status).toBe(200);
+		expect(response.headers.get("Content-Type")).toBe("text/csv; charset=utf-8");
+		expect(response.headers.get("Content-Disposition")).toBe(disposition);
+		expect(await response.text()).toBe(csv);
+	});
+});
+
+describe("lookup errors", () => {
+	it("keeps the container's status and error body", async () => {
+		const body = JSON.stringify({
+			code: "underscore_not_allowed",
+			error: "label not_a_domain has an underscore, which is only allowed for service lookups such as SRV and TXT",
+		});
+		const testEnv = {
+			...env,
+			RESOLVER: fakeResolver(
+				() => new Response(body, { status: 400, headers: { "Content-Type": "application/json; charset=utf-8" } }),
+			),
+		};
+		const request = new IncomingRequest("http://example.com/api/v1/lookup?domain=not_a_domain&type=A");
+		const ctx = createExecutionContext();
+		const response = await worker.fetch(request, testEnv, ctx);
+		await waitOnExecutionContext(ctx);
+		expect(response.status).toBe(400);
+		expect(await response.text()).toBe(body);
+	});
+});